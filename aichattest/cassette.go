@@ -0,0 +1,317 @@
+package aichattest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode selects whether a Recorder replays or records HTTP interactions
+type Mode int
+
+const (
+	// ModeReplay serves recorded responses and fails on requests without a recording
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the network and records the responses
+	ModeRecord
+	// ModeReplayOrRecord replays existing recordings and records missing ones
+	ModeReplayOrRecord
+)
+
+// Redacted replaces redacted header and query values in cassettes
+const Redacted = "REDACTED"
+
+// DefaultRedactHeaders are the headers redacted by a Recorder
+var DefaultRedactHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "Api-Key", "X-Goog-Api-Key",
+}
+
+// DefaultRedactQuery are the query parameters redacted by a Recorder
+var DefaultRedactQuery = []string{"key", "api_key", "access_token"}
+
+// Recorder is an http.RoundTripper that records request/response pairs to cassette
+// files and replays them offline. Cassettes are keyed by a hash of the normalized
+// request (method, URL with redacted credentials, and JSON body with sorted keys),
+// so the same request always maps to the same file. Streaming (SSE) responses are
+// passed through while recording and replayed verbatim.
+type Recorder struct {
+	// Dir is the directory of the cassette files
+	Dir string
+	// Mode selects replay or record
+	Mode Mode
+	// Base sends requests when recording (default http.DefaultTransport)
+	Base http.RoundTripper
+	// RedactHeaders lists the headers redacted in cassettes (default DefaultRedactHeaders)
+	RedactHeaders []string
+	// RedactQuery lists the query parameters redacted in cassettes and keys (default DefaultRedactQuery)
+	RedactQuery []string
+	// Normalize optionally rewrites request bodies before hashing, e.g. to drop timestamps
+	Normalize func(body []byte) []byte
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// NewRecorder returns a Recorder for the cassette directory
+func NewRecorder(dir string, mode Mode) *Recorder {
+	return &Recorder{Dir: dir, Mode: mode}
+}
+
+// ModeFromEnv returns ModeRecord if the environment variable is "record",
+// ModeReplayOrRecord if it is "auto", and ModeReplay otherwise
+func ModeFromEnv(name string) Mode {
+	switch os.Getenv(name) {
+	case "record":
+		return ModeRecord
+	case "auto":
+		return ModeReplayOrRecord
+	}
+	return ModeReplay
+}
+
+// Client returns an HTTP client using the recorder as its transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Cassette is a recorded HTTP interaction
+type Cassette struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is a recorded request
+type CassetteRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// CassetteResponse is a recorded response.
+// Body holds text bodies and BodyBase64 holds binary ones.
+type CassetteResponse struct {
+	Status     int         `json:"status"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"`
+	// Truncated reports that the body was closed before it was fully read,
+	// so the recording only holds the part that was read
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+	key := r.key(req, body)
+	path := r.path(key)
+
+	if r.Mode != ModeRecord {
+		cassette, err := readCassette(path)
+		if err == nil {
+			return cassette.response(req), nil
+		}
+		if r.Mode == ModeReplay || !os.IsNotExist(err) {
+			return nil, fmt.Errorf("no recording for %s %s in %s: %w", req.Method, r.redactURL(req.URL), path, err)
+		}
+	}
+
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	resp, err := base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	cassette := &Cassette{
+		Request: CassetteRequest{
+			Method:  req.Method,
+			URL:     r.redactURL(req.URL),
+			Headers: r.redactHeaders(req.Header),
+			Body:    string(body),
+		},
+		Response: CassetteResponse{
+			Status:  resp.StatusCode,
+			Headers: r.redactHeaders(resp.Header),
+		},
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, size: resp.ContentLength, save: func(data []byte, truncated bool) error {
+		cassette.Response.Truncated = truncated
+		if utf8.Valid(data) {
+			cassette.Response.Body = string(data)
+		} else {
+			cassette.Response.BodyBase64 = data
+		}
+		return writeCassette(path, cassette)
+	}}
+	return resp, nil
+}
+
+// key hashes the normalized request. Repeated identical requests get numbered keys
+// so that a conversation sending the same request twice replays both responses.
+func (r *Recorder) key(req *http.Request, body []byte) string {
+	if r.Normalize != nil {
+		body = r.Normalize(body)
+	}
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		body, _ = json.Marshal(v)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, r.redactURL(req.URL))
+	h.Write(body)
+	key := hex.EncodeToString(h.Sum(nil))[:16]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen == nil {
+		r.seen = make(map[string]int)
+	}
+	r.seen[key]++
+	if n := r.seen[key]; n > 1 {
+		key = fmt.Sprintf("%s-%d", key, n)
+	}
+	return key
+}
+
+func (r *Recorder) path(key string) string {
+	return filepath.Join(r.Dir, key+".json")
+}
+
+func (r *Recorder) redactURL(u *url.URL) string {
+	c := *u
+	names := r.RedactQuery
+	if names == nil {
+		names = DefaultRedactQuery
+	}
+	q := c.Query()
+	for _, name := range names {
+		if q.Has(name) {
+			q.Set(name, Redacted)
+		}
+	}
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+func (r *Recorder) redactHeaders(h http.Header) http.Header {
+	names := r.RedactHeaders
+	if names == nil {
+		names = DefaultRedactHeaders
+	}
+	c := h.Clone()
+	for _, name := range names {
+		if c.Get(name) != "" {
+			c.Set(name, Redacted)
+		}
+	}
+	return c
+}
+
+// response builds the replayed response
+func (c *Cassette) response(req *http.Request) *http.Response {
+	body := []byte(c.Response.Body)
+	if c.Response.BodyBase64 != nil {
+		body = c.Response.BodyBase64
+	}
+	headers := c.Response.Headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.Response.Status, http.StatusText(c.Response.Status)),
+		StatusCode:    c.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func readCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette: %w", err)
+	}
+	return &c, nil
+}
+
+func writeCassette(path string, c *Cassette) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// recordingBody passes a response body through while capturing it,
+// and saves the cassette once the body is fully read or closed
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	size int64 // content length, or -1 if unknown
+	save func(data []byte, truncated bool) error
+	done bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		if serr := b.finish(false); serr != nil {
+			return n, serr
+		}
+	}
+	return n, err
+}
+
+// Close records what was read so far without draining the rest, which would block on
+// streams the caller stopped reading
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if serr := b.finish(b.size < 0 || int64(b.buf.Len()) < b.size); serr != nil {
+		return serr
+	}
+	return err
+}
+
+func (b *recordingBody) finish(truncated bool) error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	return b.save(b.buf.Bytes(), truncated)
+}
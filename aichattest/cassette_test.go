@@ -0,0 +1,151 @@
+package aichattest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{`{"delta":"Hel"}`, `{"delta":"lo"}`, `[DONE]`} {
+				io.WriteString(w, "data: "+chunk+"\n\n")
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, `{"call":`+string(rune('0'+calls))+`}`)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	send := func(client *http.Client, body string) (string, error) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/chat/completions?key=secret", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	recorder := NewRecorder(dir, ModeRecord)
+	out, err := send(recorder.Client(), `{"model":"m","messages":[]}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"call":1}`, out)
+	// The same request again is recorded separately
+	out, err = send(recorder.Client(), `{"messages":[],"model":"m"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"call":2}`, out)
+	stream, err := send(recorder.Client(), `{"model":"m","stream":true}`)
+	require.NoError(t, err)
+	assert.Contains(t, stream, "data: [DONE]")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "secret")
+		assert.Contains(t, string(data), Redacted)
+	}
+
+	// Replay offline, with keys independent of JSON key order
+	server.Close()
+	replayer := NewRecorder(dir, ModeReplay)
+	out, err = send(replayer.Client(), `{"messages":[],"model":"m"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"call":1}`, out)
+	out, err = send(replayer.Client(), `{"model":"m","messages":[]}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"call":2}`, out)
+	out, err = send(replayer.Client(), `{"model":"m","stream":true}`)
+	require.NoError(t, err)
+	assert.Equal(t, stream, out)
+
+	_, err = send(replayer.Client(), `{"model":"other"}`)
+	assert.ErrorContains(t, err, "no recording for POST")
+	assert.Equal(t, 3, calls)
+}
+
+func TestRecorderReplayOrRecord(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte{0xff, 0xfe, 0x00})
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder(t.TempDir(), ModeReplayOrRecord)
+	for i := 0; i < 2; i++ {
+		recorder.seen = nil
+		resp, err := recorder.Client().Get(server.URL)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, []byte{0xff, 0xfe, 0x00}, body)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestModeFromEnv(t *testing.T) {
+	t.Setenv("CASSETTE_MODE", "record")
+	assert.Equal(t, ModeRecord, ModeFromEnv("CASSETTE_MODE"))
+	t.Setenv("CASSETTE_MODE", "auto")
+	assert.Equal(t, ModeReplayOrRecord, ModeFromEnv("CASSETTE_MODE"))
+	t.Setenv("CASSETTE_MODE", "")
+	assert.Equal(t, ModeReplay, ModeFromEnv("CASSETTE_MODE"))
+}
+
+func TestRecorderClosedStream(t *testing.T) {
+	closed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"delta\":\"Hel\"}\n\n")
+		w.(http.Flusher).Flush()
+		// The stream never ends on its own
+		select {
+		case <-r.Context().Done():
+		case <-closed:
+		}
+	}))
+	defer server.Close()
+	defer close(closed)
+	dir := t.TempDir()
+
+	resp, err := NewRecorder(dir, ModeRecord).Client().Post(server.URL, "application/json", strings.NewReader(`{"stream":true}`))
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, err := resp.Body.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close(), "closing does not wait for the rest of the stream")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var cassette Cassette
+	require.NoError(t, json.Unmarshal(data, &cassette))
+	assert.True(t, cassette.Response.Truncated)
+	assert.Equal(t, string(buf[:n]), cassette.Response.Body)
+}
@@ -0,0 +1,30 @@
+package aichattest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	now := clock.After(0)
+	assert.Equal(t, start, <-now)
+
+	later := clock.After(time.Minute)
+	assert.Equal(t, 1, clock.Timers())
+	clock.Advance(30 * time.Second)
+	select {
+	case <-later:
+		t.Fatal("timer fired early")
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-later)
+	assert.Zero(t, clock.Timers())
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+}
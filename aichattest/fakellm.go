@@ -0,0 +1,313 @@
+package aichattest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/presbrey/aichat"
+	"github.com/presbrey/aichat/schema/openrouter"
+)
+
+// FakeLLM is an in-process OpenAI/OpenRouter-compatible chat completions server
+// whose replies are scripted by a sequence of expectations. Each request must match
+// the next expectation; mismatches and unconsumed expectations fail the test.
+type FakeLLM struct {
+	*httptest.Server
+
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	next         int
+	requests     []*openrouter.Request
+}
+
+// NewFakeLLM starts a fake model server that is closed, and checked for
+// unconsumed expectations, when the test finishes
+func NewFakeLLM(t testing.TB) *FakeLLM {
+	f := &FakeLLM{t: t}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(func() {
+		f.Close()
+		f.AssertConsumed()
+	})
+	return f
+}
+
+// Client returns an openrouter.Client sending requests to the fake server
+func (f *FakeLLM) Client() *openrouter.Client {
+	return &openrouter.Client{BaseURL: f.URL, HTTPClient: f.Server.Client()}
+}
+
+// Expect appends an expectation to the script. Without matchers it matches any request.
+func (f *FakeLLM) Expect() *Expectation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := &Expectation{index: len(f.expectations) + 1}
+	f.expectations = append(f.expectations, e)
+	return e
+}
+
+// Requests returns the requests received so far
+func (f *FakeLLM) Requests() []*openrouter.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*openrouter.Request(nil), f.requests...)
+}
+
+// AssertConsumed fails the test if any expectation has not been consumed
+func (f *FakeLLM) AssertConsumed() bool {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if remaining := len(f.expectations) - f.next; remaining > 0 {
+		f.t.Errorf("fake LLM: %d of %d expectations not consumed", remaining, len(f.expectations))
+		return false
+	}
+	return true
+}
+
+// Expectation matches a request and scripts the reply
+type Expectation struct {
+	index    int
+	matchers []func(req *openrouter.Request) error
+	reply    *aichat.Message
+	usage    *aichat.Usage
+	status   int
+	message  string
+}
+
+// WhenUser matches requests whose last user message contains substr
+func (e *Expectation) WhenUser(substr string) *Expectation {
+	e.matchers = append(e.matchers, func(req *openrouter.Request) error {
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			if msg := req.Messages[i]; msg.Role == "user" {
+				if text := messageText(msg); !strings.Contains(text, substr) {
+					return fmt.Errorf("last user message %q does not contain %q", text, substr)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("no user message")
+	})
+	return e
+}
+
+// WhenToolResult matches requests ending with a tool result for the named tool that contains substr
+func (e *Expectation) WhenToolResult(name, substr string) *Expectation {
+	e.matchers = append(e.matchers, func(req *openrouter.Request) error {
+		for i := len(req.Messages) - 1; i >= 0 && req.Messages[i].Role == "tool"; i-- {
+			msg := req.Messages[i]
+			if msg.Name == name && strings.Contains(messageText(msg), substr) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no pending %s tool result containing %q", name, substr)
+	})
+	return e
+}
+
+// When matches requests for which fn returns true
+func (e *Expectation) When(fn func(req *openrouter.Request) bool) *Expectation {
+	e.matchers = append(e.matchers, func(req *openrouter.Request) error {
+		if !fn(req) {
+			return fmt.Errorf("custom matcher did not match")
+		}
+		return nil
+	})
+	return e
+}
+
+// Reply replies with an assistant text message
+func (e *Expectation) Reply(content string) *Expectation {
+	e.reply = &aichat.Message{Role: "assistant", Content: content}
+	return e
+}
+
+// ReplyToolCalls replies with an assistant message calling tools.
+// Missing call IDs and types are filled in.
+func (e *Expectation) ReplyToolCalls(calls ...aichat.ToolCall) *Expectation {
+	calls = slices.Clone(calls)
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = fmt.Sprintf("call_%d_%d", e.index, i+1)
+		}
+		if calls[i].Type == "" {
+			calls[i].Type = "function"
+		}
+	}
+	e.reply = &aichat.Message{Role: "assistant", Content: "", ToolCalls: calls}
+	return e
+}
+
+// ReplyError replies with an API error
+func (e *Expectation) ReplyError(status int, message string) *Expectation {
+	e.status, e.message = status, message
+	return e
+}
+
+// WithUsage adds token usage to the reply
+func (e *Expectation) WithUsage(u aichat.Usage) *Expectation {
+	e.usage = &u
+	return e
+}
+
+// ToolCall builds a tool call with JSON-encoded arguments
+func ToolCall(name string, args any) aichat.ToolCall {
+	b, err := json.Marshal(args)
+	if err != nil {
+		panic(fmt.Sprintf("aichattest: failed to marshal tool call arguments: %v", err))
+	}
+	return aichat.ToolCall{Type: "function", Function: aichat.Function{Name: name, Arguments: string(b)}}
+}
+
+func (f *FakeLLM) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		f.fail(w, http.StatusNotFound, "unexpected request %s %s", r.Method, r.URL.Path)
+		return
+	}
+	var req openrouter.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.fail(w, http.StatusBadRequest, "invalid request: %v", err)
+		return
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, &req)
+	if f.next >= len(f.expectations) {
+		f.mu.Unlock()
+		f.fail(w, http.StatusInternalServerError, "unexpected request %d: no expectations left", len(f.requests))
+		return
+	}
+	e := f.expectations[f.next]
+	f.next++
+	f.mu.Unlock()
+
+	for _, match := range e.matchers {
+		if err := match(&req); err != nil {
+			f.fail(w, http.StatusInternalServerError, "expectation %d: %v", e.index, err)
+			return
+		}
+	}
+	if e.status != 0 {
+		writeError(w, e.status, e.message)
+		return
+	}
+	reply := e.reply
+	if reply == nil {
+		reply = &aichat.Message{Role: "assistant", Content: ""}
+	}
+	if req.Stream {
+		writeStream(w, &req, reply, e.usage)
+		return
+	}
+	writeCompletion(w, &req, reply, e.usage)
+}
+
+func (f *FakeLLM) fail(w http.ResponseWriter, status int, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	f.t.Errorf("fake LLM: %s", message)
+	writeError(w, status, message)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": status, "message": message}})
+}
+
+func finishReason(reply *aichat.Message) string {
+	if len(reply.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func usageJSON(u *aichat.Usage) map[string]any {
+	if u == nil {
+		return nil
+	}
+	return map[string]any{
+		"prompt_tokens":     u.PromptTokens,
+		"completion_tokens": u.CompletionTokens,
+		"total_tokens":      u.TotalTokens,
+		"cost":              u.Cost,
+	}
+}
+
+func writeCompletion(w http.ResponseWriter, req *openrouter.Request, reply *aichat.Message, usage *aichat.Usage) {
+	resp := map[string]any{
+		"id":      "gen-fake",
+		"object":  "chat.completion",
+		"model":   req.Model,
+		"choices": []any{map[string]any{"index": 0, "message": reply, "finish_reason": finishReason(reply)}},
+	}
+	if u := usageJSON(usage); u != nil {
+		resp["usage"] = u
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeStream writes the reply as server-sent chat.completion.chunk events
+func writeStream(w http.ResponseWriter, req *openrouter.Request, reply *aichat.Message, usage *aichat.Usage) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	send := func(delta map[string]any, finish any, usage map[string]any) {
+		chunk := map[string]any{
+			"id":      "gen-fake",
+			"object":  "chat.completion.chunk",
+			"model":   req.Model,
+			"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+		if usage != nil {
+			chunk["usage"] = usage
+		}
+		b, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(map[string]any{"role": "assistant", "content": ""}, nil, nil)
+	for _, word := range strings.SplitAfter(reply.ContentString(), " ") {
+		if word != "" {
+			send(map[string]any{"content": word}, nil, nil)
+		}
+	}
+	for i, call := range reply.ToolCalls {
+		send(map[string]any{"tool_calls": []any{map[string]any{
+			"index":    i,
+			"id":       call.ID,
+			"type":     call.Type,
+			"function": map[string]any{"name": call.Function.Name, "arguments": call.Function.Arguments},
+		}}}, nil, nil)
+	}
+	send(map[string]any{}, finishReason(reply), usageJSON(usage))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// messageText returns the text of a message, joining text parts
+func messageText(msg *aichat.Message) string {
+	if s := msg.ContentString(); s != "" {
+		return s
+	}
+	parts, _ := msg.ContentParts()
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == aichat.PartTypeText {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
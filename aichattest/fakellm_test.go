@@ -0,0 +1,161 @@
+package aichattest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+	"github.com/presbrey/aichat/schema/openrouter"
+)
+
+func TestFakeLLMAgentLoop(t *testing.T) {
+	llm := NewFakeLLM(t)
+	llm.Expect().WhenUser("weather in Boston").
+		ReplyToolCalls(ToolCall("get_weather", map[string]any{"city": "Boston"}))
+	llm.Expect().WhenToolResult("get_weather", "sunny").
+		Reply("It is sunny in Boston.").
+		WithUsage(aichat.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+
+	ctx := context.Background()
+	client := llm.Client()
+	chat := new(aichat.Chat)
+	chat.AddUserContent("What's the weather in Boston?")
+	for turn := 0; turn < 5; turn++ {
+		msg, err := client.Complete(ctx, chat.CompletionRequest("test-model"))
+		require.NoError(t, err)
+		chat.AddMessage(msg)
+		if len(msg.ToolCalls) == 0 {
+			break
+		}
+		require.NoError(t, chat.RangePendingToolCalls(func(tc *aichat.ToolCallContext) error {
+			args, err := tc.Arguments()
+			require.NoError(t, err)
+			assert.Equal(t, "Boston", args["city"])
+			return tc.Return(map[string]any{"condition": "sunny"})
+		}))
+	}
+
+	assert.Equal(t, "It is sunny in Boston.", chat.LastMessage().Content)
+	assert.Equal(t, 15, chat.Usage().TotalTokens)
+	assert.Equal(t, "call_1_1", chat.Messages[1].ToolCalls[0].ID)
+	requests := llm.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "test-model", requests[1].Model)
+	assert.Len(t, requests[1].Messages, 3)
+	assert.True(t, llm.AssertConsumed())
+}
+
+func TestFakeLLMStream(t *testing.T) {
+	llm := NewFakeLLM(t)
+	llm.Expect().Reply("Hello there world")
+	llm.Expect().ReplyToolCalls(ToolCall("lookup", map[string]any{"q": "x"}))
+
+	stream := func() (content string, calls []string, finish string) {
+		body, _ := json.Marshal(&openrouter.Request{Model: "m", Stream: true, Messages: []*aichat.Message{{Role: "user", Content: "hi"}}})
+		resp, err := http.Post(llm.URL+"/chat/completions", "application/json", strings.NewReader(string(body)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content   string            `json:"content"`
+						ToolCalls []aichat.ToolCall `json:"tool_calls"`
+					} `json:"delta"`
+					FinishReason string `json:"finish_reason"`
+				} `json:"choices"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			content += chunk.Choices[0].Delta.Content
+			for _, call := range chunk.Choices[0].Delta.ToolCalls {
+				calls = append(calls, call.Function.Name+call.Function.Arguments)
+			}
+			if fr := chunk.Choices[0].FinishReason; fr != "" {
+				finish = fr
+			}
+		}
+		return
+	}
+
+	content, calls, finish := stream()
+	assert.Equal(t, "Hello there world", content)
+	assert.Empty(t, calls)
+	assert.Equal(t, "stop", finish)
+
+	content, calls, finish = stream()
+	assert.Empty(t, content)
+	assert.Equal(t, []string{`lookup{"q":"x"}`}, calls)
+	assert.Equal(t, "tool_calls", finish)
+}
+
+func TestFakeLLMErrors(t *testing.T) {
+	llm := NewFakeLLM(t)
+	llm.Expect().ReplyError(http.StatusTooManyRequests, "slow down")
+	_, err := llm.Client().Complete(context.Background(), &aichat.CompletionRequest{Model: "m"})
+	assert.ErrorIs(t, err, aichat.ErrRateLimited)
+}
+
+// recordingT captures test failures reported by the fake server
+type recordingT struct {
+	*testing.T
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFakeLLMMismatch(t *testing.T) {
+	rt := &recordingT{T: t}
+	llm := NewFakeLLM(rt)
+	llm.Expect().WhenUser("hello").Reply("hi")
+	llm.Expect().Reply("second")
+
+	chat := new(aichat.Chat)
+	chat.AddUserContent("goodbye")
+	_, err := llm.Client().Complete(context.Background(), chat.CompletionRequest("m"))
+	assert.Error(t, err)
+	require.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], `expectation 1: last user message "goodbye" does not contain "hello"`)
+
+	assert.False(t, llm.AssertConsumed())
+	assert.Contains(t, rt.errors[1], "1 of 2 expectations not consumed")
+
+	// The script continues with the next expectation, then runs out
+	llm.Expect().WhenToolResult("lookup", "x")
+	msg, err := llm.Client().Complete(context.Background(), chat.CompletionRequest("m"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", msg.Content)
+	_, err = llm.Client().Complete(context.Background(), chat.CompletionRequest("m"))
+	assert.Error(t, err)
+	_, err = llm.Client().Complete(context.Background(), chat.CompletionRequest("m"))
+	assert.Error(t, err)
+	assert.Contains(t, rt.errors[len(rt.errors)-2], "no pending lookup tool result")
+	assert.Contains(t, rt.errors[len(rt.errors)-1], "no expectations left")
+}
+
+func TestFakeLLMReplyToolCallsCopiesCalls(t *testing.T) {
+	llm := NewFakeLLM(t)
+	calls := []aichat.ToolCall{ToolCall("lookup", map[string]any{"q": "x"})}
+	llm.Expect().ReplyToolCalls(calls...)
+	assert.Empty(t, calls[0].ID, "the caller's calls are not modified")
+
+	msg, err := llm.Client().Complete(context.Background(), &aichat.CompletionRequest{Model: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, "call_1_1", msg.ToolCalls[0].ID)
+}
@@ -0,0 +1,266 @@
+package aichat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Attachment references binary data held in an AttachmentStore.
+// A part with an Attachment has its inline data removed until it is inlined again.
+type Attachment struct {
+	// Hash is the content hash of the data, e.g. "sha256:<hex>"
+	Hash     string `json:"hash"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int    `json:"size,omitempty"`
+	// Detail is the detail level of an image part, kept here while its image URL is removed
+	Detail string `json:"detail,omitempty"`
+}
+
+// AttachmentStore stores binary attachments as content-addressed blobs through the S3 interface.
+// Identical data is stored once, no matter how many chats reference it.
+type AttachmentStore struct {
+	S3 S3
+	// Prefix is prepended to blob keys (default "attachments/")
+	Prefix string
+	// URL optionally maps a blob key to a URL providers can fetch directly.
+	// When set, image and video parts are passed as URLs instead of data URLs.
+	URL func(key string) string
+}
+
+// NewAttachmentStore creates a new attachment store
+func NewAttachmentStore(s3 S3) *AttachmentStore {
+	return &AttachmentStore{S3: s3}
+}
+
+// Key returns the storage key for an attachment
+func (s *AttachmentStore) Key(a *Attachment) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "attachments/"
+	}
+	return prefix + strings.Replace(a.Hash, ":", "/", 1)
+}
+
+// Put stores data and returns a reference to it. Data is written on every call,
+// so blobs deleted from storage are restored by the next Save.
+func (s *AttachmentStore) Put(ctx context.Context, mimeType string, data []byte) (*Attachment, error) {
+	sum := sha256.Sum256(data)
+	a := &Attachment{
+		Hash:     "sha256:" + hex.EncodeToString(sum[:]),
+		MIMEType: mimeType,
+		Size:     len(data),
+	}
+	if err := s.S3.Put(ctx, s.Key(a), bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to put attachment: %w", err)
+	}
+	return a, nil
+}
+
+// Get retrieves the data of an attachment
+func (s *AttachmentStore) Get(ctx context.Context, a *Attachment) ([]byte, error) {
+	reader, err := s.S3.Get(ctx, s.Key(a))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Externalize returns messages with inline binary data (data URLs and input audio) moved
+// into the store and replaced by attachment references, ready to be persisted. Messages
+// without inline data are returned as is; the others are copied, so the input messages
+// keep their data.
+func (s *AttachmentStore) Externalize(ctx context.Context, messages []*Message) ([]*Message, error) {
+	out := make([]*Message, len(messages))
+	for i, msg := range messages {
+		out[i] = msg
+		parts, err := msg.ContentParts()
+		if err != nil {
+			return nil, err
+		}
+		var externalized []*Part
+		for j, p := range parts {
+			mimeType, data, ok, err := inlineData(p)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			a, err := s.Put(ctx, mimeType, data)
+			if err != nil {
+				return nil, err
+			}
+			if externalized == nil {
+				externalized = make([]*Part, len(parts))
+				copy(externalized, parts)
+			}
+			q := *p
+			q.Attachment = a
+			clearInlineData(&q)
+			externalized[j] = &q
+		}
+		if externalized != nil {
+			m := *msg
+			m.SetContentParts(externalized...)
+			out[i] = &m
+		}
+	}
+	return out, nil
+}
+
+// Inline returns messages with attachment references replaced by their data,
+// ready to be sent to a provider. Messages without attachments are returned as is;
+// the others are copied, so the input messages are not modified.
+func (s *AttachmentStore) Inline(ctx context.Context, messages []*Message) ([]*Message, error) {
+	out := make([]*Message, len(messages))
+	for i, msg := range messages {
+		out[i] = msg
+		parts, err := msg.ContentParts()
+		if err != nil {
+			return nil, err
+		}
+		var inlined []*Part
+		for j, p := range parts {
+			if p.Attachment == nil {
+				continue
+			}
+			if inlined == nil {
+				inlined = make([]*Part, len(parts))
+				copy(inlined, parts)
+			}
+			if inlined[j], err = s.inlinePart(ctx, p); err != nil {
+				return nil, err
+			}
+		}
+		if inlined != nil {
+			m := *msg
+			m.SetContentParts(inlined...)
+			out[i] = &m
+		}
+	}
+	return out, nil
+}
+
+// inlinePart returns a copy of the part with its attachment data restored
+func (s *AttachmentStore) inlinePart(ctx context.Context, p *Part) (*Part, error) {
+	a := p.Attachment
+	url := ""
+	if s.URL != nil {
+		url = s.URL(s.Key(a))
+	}
+	var data []byte
+	if url == "" || p.Type == PartTypeInputAudio || p.Type == PartTypeFile {
+		var err error
+		if data, err = s.Get(ctx, a); err != nil {
+			return nil, err
+		}
+		url = DataURL(a.MIMEType, data)
+	}
+
+	q := *p
+	q.Attachment = nil
+	switch p.Type {
+	case PartTypeImageURL:
+		q.ImageURL = &ImageURL{URL: url, Detail: a.Detail}
+		if p.ImageURL != nil && p.ImageURL.Detail != "" {
+			q.ImageURL.Detail = p.ImageURL.Detail
+		}
+	case PartTypeVideoURL:
+		q.VideoURL = &VideoURL{URL: url}
+	case PartTypeInputAudio:
+		q.InputAudio = &InputAudio{
+			Data:   base64.StdEncoding.EncodeToString(data),
+			Format: strings.TrimPrefix(a.MIMEType, "audio/"),
+		}
+	case PartTypeFile:
+		q.File = &File{FileData: url}
+		if p.File != nil {
+			q.File.Filename = p.File.Filename
+		}
+	default:
+		return nil, fmt.Errorf("unsupported attachment part type %q", p.Type)
+	}
+	return &q, nil
+}
+
+// inlineData returns the binary data carried inline by a part, if any
+func inlineData(p *Part) (string, []byte, bool, error) {
+	var url string
+	switch {
+	case p.Type == PartTypeImageURL && p.ImageURL != nil:
+		url = p.ImageURL.URL
+	case p.Type == PartTypeVideoURL && p.VideoURL != nil:
+		url = p.VideoURL.URL
+	case p.Type == PartTypeFile && p.File != nil:
+		url = p.File.FileData
+	case p.Type == PartTypeInputAudio && p.InputAudio != nil && p.InputAudio.Data != "":
+		if p.InputAudio.Format == "" {
+			return "", nil, false, fmt.Errorf("input audio has no format")
+		}
+		data, err := base64.StdEncoding.DecodeString(p.InputAudio.Data)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("invalid input audio: %w", err)
+		}
+		return "audio/" + p.InputAudio.Format, data, true, nil
+	}
+	if !strings.HasPrefix(url, "data:") {
+		return "", nil, false, nil
+	}
+	mimeType, data, err := ParseDataURL(url)
+	if err != nil {
+		return "", nil, false, err
+	}
+	return mimeType, data, true, nil
+}
+
+// clearInlineData removes the inline data of a part, keeping its other fields.
+// The detail of an image part moves to its attachment.
+func clearInlineData(p *Part) {
+	switch p.Type {
+	case PartTypeImageURL:
+		if p.ImageURL != nil && p.Attachment != nil {
+			p.Attachment.Detail = p.ImageURL.Detail
+		}
+		p.ImageURL = nil
+	case PartTypeVideoURL:
+		p.VideoURL = nil
+	case PartTypeFile:
+		if p.File == nil || p.File.Filename == "" {
+			p.File = nil
+		} else {
+			p.File = &File{Filename: p.File.Filename}
+		}
+	case PartTypeInputAudio:
+		p.InputAudio = nil
+	}
+}
+
+// InlineAttachments returns the chat messages with attachments inlined for a provider request.
+// Without an attachment store in the options the messages are returned unchanged.
+func (chat *Chat) InlineAttachments(ctx context.Context) ([]*Message, error) {
+	if chat.Options.Attachments == nil {
+		return chat.Messages, nil
+	}
+	return chat.Options.Attachments.Inline(ctx, chat.Messages)
+}
+
+// Completer returns a Completer that inlines attachment references in request messages
+// before calling client, so that chats loaded with references can be sent as is
+func (s *AttachmentStore) Completer(client Completer) Completer {
+	return CompleterFunc(func(ctx context.Context, req *CompletionRequest) (*Message, error) {
+		messages, err := s.Inline(ctx, req.Messages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inline attachments: %w", err)
+		}
+		inlined := *req
+		inlined.Messages = messages
+		return client.Complete(ctx, &inlined)
+	})
+}
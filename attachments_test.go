@@ -0,0 +1,249 @@
+package aichat_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestAttachmentStore(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	store := aichat.NewAttachmentStore(s3)
+	opts := aichat.Options{S3: s3, Attachments: store}
+
+	png := []byte("\x89PNG fake image")
+	pdf := []byte("%PDF-1.4 fake document")
+	wav := []byte("RIFF fake audio")
+
+	newChat := func(id string) *aichat.Chat {
+		chat := &aichat.Chat{ID: id, Options: opts}
+		msg := chat.AddUserContent(nil)
+		msg.SetContentParts(
+			aichat.TextPart("Look at these"),
+			aichat.ImagePartFromBytes("image/png", png),
+			aichat.FilePart("doc.pdf", "application/pdf", pdf),
+			aichat.AudioPart("wav", wav),
+			aichat.ImagePart("https://example.com/cat.jpg"),
+		)
+		return chat
+	}
+
+	chat1 := newChat("chat-1")
+	chat2 := newChat("chat-2")
+	require.NoError(t, chat1.Save(ctx, "chat-1"))
+	require.NoError(t, chat2.Save(ctx, "chat-2"))
+
+	// The chats in memory keep their inline data
+	parts, err := chat1.Messages[0].ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, aichat.ImagePartFromBytes("image/png", png), parts[1])
+	assert.Nil(t, parts[1].Attachment)
+
+	// Saved chats no longer carry the inline data
+	raw, ok := s3.GetRawData("chat-1")
+	require.True(t, ok)
+	assert.NotContains(t, string(raw), "data:image/png")
+	assert.Contains(t, string(raw), `"attachment":{"hash":"sha256:`)
+	assert.Contains(t, string(raw), `"filename":"doc.pdf"`)
+	assert.Contains(t, string(raw), "https://example.com/cat.jpg")
+
+	// Blobs are deduplicated across chats
+	blobs := 0
+	for key := range s3.data {
+		if strings.HasPrefix(key, "attachments/sha256/") {
+			blobs++
+		}
+	}
+	assert.Equal(t, 3, blobs)
+
+	// Loaded chats inline the attachments when building a request
+	loaded, err := aichat.NewStorage(opts).Load(ctx, "chat-2")
+	require.NoError(t, err)
+	messages, err := loaded.InlineAttachments(ctx)
+	require.NoError(t, err)
+	parts, err = messages[0].ContentParts()
+	require.NoError(t, err)
+	require.Len(t, parts, 5)
+	assert.Equal(t, aichat.TextPart("Look at these"), parts[0])
+	assert.Equal(t, aichat.ImagePartFromBytes("image/png", png), parts[1])
+	assert.Equal(t, aichat.FilePart("doc.pdf", "application/pdf", pdf), parts[2])
+	assert.Equal(t, aichat.AudioPart("wav", wav), parts[3])
+	assert.Equal(t, aichat.ImagePart("https://example.com/cat.jpg"), parts[4])
+
+	// The stored chat still holds references
+	storedParts, err := loaded.Messages[0].ContentParts()
+	require.NoError(t, err)
+	assert.NotNil(t, storedParts[1].Attachment)
+
+	b, err := json.Marshal(messages[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "attachment")
+}
+
+func TestAttachmentStoreURL(t *testing.T) {
+	ctx := context.Background()
+	store := aichat.NewAttachmentStore(newMockS3())
+	store.Prefix = "blobs/"
+	store.URL = func(key string) string { return "https://cdn.example.com/" + key }
+
+	msg := &aichat.Message{Role: "user"}
+	msg.SetContentParts(aichat.ImagePartFromBytes("image/png", []byte("png")))
+	externalized, err := store.Externalize(ctx, []*aichat.Message{msg})
+	require.NoError(t, err)
+
+	messages, err := store.Inline(ctx, externalized)
+	require.NoError(t, err)
+	parts, err := messages[0].ContentParts()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(parts[0].ImageURL.URL, "https://cdn.example.com/blobs/sha256/"))
+}
+
+func TestAttachmentStoreImageDetail(t *testing.T) {
+	ctx := context.Background()
+	store := aichat.NewAttachmentStore(newMockS3())
+	image := aichat.ImagePartFromBytes("image/png", []byte("png"))
+	image.ImageURL.Detail = "high"
+	msg := &aichat.Message{Role: "user"}
+	msg.SetContentParts(image)
+
+	// The detail is kept with the attachment rather than in an image URL without URL
+	externalized, err := store.Externalize(ctx, []*aichat.Message{msg})
+	require.NoError(t, err)
+	parts, err := externalized[0].ContentParts()
+	require.NoError(t, err)
+	assert.Nil(t, parts[0].ImageURL)
+	assert.Equal(t, "high", parts[0].Attachment.Detail)
+	b, err := json.Marshal(parts[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), `"url":""`)
+
+	messages, err := store.Inline(ctx, externalized)
+	require.NoError(t, err)
+	parts, err = messages[0].ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, image, parts[0])
+}
+
+func TestAttachmentStoreErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// Missing blob
+	s3 := newMockS3()
+	store := aichat.NewAttachmentStore(s3)
+	msg := &aichat.Message{Role: "user"}
+	msg.SetContentParts(&aichat.Part{Type: aichat.PartTypeImageURL, Attachment: &aichat.Attachment{Hash: "sha256:missing"}})
+	_, err := store.Inline(ctx, []*aichat.Message{msg})
+	assert.Error(t, err)
+
+	// Invalid inline data
+	msg.SetContentParts(aichat.ImagePart("data:image/png;base64,!!!"))
+	_, err = store.Externalize(ctx, []*aichat.Message{msg})
+	assert.Error(t, err)
+	msg.SetContentParts(aichat.AudioPart("", []byte("RIFF")))
+	_, err = store.Externalize(ctx, []*aichat.Message{msg})
+	assert.ErrorContains(t, err, "input audio has no format")
+
+	// Deleted blobs are written again
+	image := &aichat.Message{Role: "user"}
+	image.SetContentParts(aichat.ImagePartFromBytes("image/png", []byte("png")))
+	externalized, err := store.Externalize(ctx, []*aichat.Message{image})
+	require.NoError(t, err)
+	parts, err := externalized[0].ContentParts()
+	require.NoError(t, err)
+	require.NoError(t, s3.Delete(ctx, store.Key(parts[0].Attachment)))
+	_, err = store.Externalize(ctx, []*aichat.Message{image})
+	require.NoError(t, err)
+	_, err = store.Inline(ctx, externalized)
+	assert.NoError(t, err)
+
+	// Save reports attachment errors
+	chat := &aichat.Chat{Options: aichat.Options{S3: newMockS3(), Attachments: store}}
+	chat.AddMessage(msg)
+	err = chat.Save(ctx, "key")
+	assert.ErrorContains(t, err, "failed to store attachments")
+
+	// Without a store messages are returned unchanged
+	plain := &aichat.Chat{}
+	plain.AddUserContent("hi")
+	messages, err := plain.InlineAttachments(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, plain.Messages, messages)
+}
+
+func TestAttachmentStoreBranchesAndCompleter(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	store := aichat.NewAttachmentStore(s3)
+	opts := aichat.Options{S3: s3, Attachments: store}
+	png := []byte("\x89PNG fake image")
+
+	chat := &aichat.Chat{ID: "chat-1", Options: opts}
+	chat.AddUserContent("hello")
+	msg := chat.AddUserContent(nil)
+	msg.SetContentParts(aichat.ImagePartFromBytes("image/png", png))
+	chat.BranchAt(1)
+	chat.AddUserContent("other branch")
+	require.NoError(t, chat.Save(ctx, "chat-1"))
+
+	// Inactive branches are externalized too
+	raw, ok := s3.GetRawData("chat-1")
+	require.True(t, ok)
+	assert.NotContains(t, string(raw), "data:image/png")
+	assert.Contains(t, string(raw), `"attachment":{"hash":"sha256:`)
+
+	loaded, err := aichat.NewStorage(opts).Load(ctx, "chat-1")
+	require.NoError(t, err)
+	require.NoError(t, loaded.SwitchBranch(msg.ID))
+
+	var sent []*aichat.Message
+	client := store.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		sent = req.Messages
+		return &aichat.Message{Role: "assistant", Content: "a cat"}, nil
+	}))
+	_, err = client.Complete(ctx, loaded.CompletionRequest("model"))
+	require.NoError(t, err)
+	require.Len(t, sent, 2)
+	parts, err := sent[1].ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, aichat.ImagePartFromBytes("image/png", png), parts[0])
+
+	// The loaded chat keeps its references
+	parts, err = loaded.Messages[1].ContentParts()
+	require.NoError(t, err)
+	assert.NotNil(t, parts[0].Attachment)
+}
+
+func TestAttachmentStoreCompactionArchive(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	store := aichat.NewAttachmentStore(s3)
+	chat := &aichat.Chat{ID: "chat-1", Options: aichat.Options{S3: s3, Attachments: store}}
+	msg := chat.AddUserContent(nil)
+	msg.SetContentParts(aichat.TextPart("what is this?"), aichat.ImagePartFromBytes("image/png", []byte("png")))
+	chat.AddAssistantContent("a cat")
+	chat.AddUserContent("thanks")
+
+	c := &aichat.Compactor{Summarize: summarizeRoles, ArchiveKey: func(*aichat.Chat) string { return "archive" }}
+	ok, err := c.Compact(ctx, chat)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	raw, ok := s3.GetRawData("archive")
+	require.True(t, ok)
+	assert.NotContains(t, string(raw), "data:image/png")
+
+	archived, err := chat.LoadCompacted(ctx, chat.Messages[0])
+	require.NoError(t, err)
+	archived, err = store.Inline(ctx, archived)
+	require.NoError(t, err)
+	parts, err := archived[0].ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, aichat.ImagePartFromBytes("image/png", []byte("png")), parts[1])
+}
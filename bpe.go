@@ -0,0 +1,106 @@
+package aichat
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bpePattern splits text into words before byte pair merging.
+// It approximates the tiktoken pattern, which relies on lookaheads RE2 does not support.
+var bpePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)| ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// BPECounter counts tokens exactly with a byte pair encoding vocabulary
+type BPECounter struct {
+	ranks map[string]int
+	// key identifies the vocabulary for CacheKey
+	key string
+}
+
+// LoadBPE loads a BPE vocabulary from a local file in tiktoken format
+// (one base64-encoded token and its rank per line)
+func LoadBPE(path string) (*BPECounter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vocab file: %w", err)
+	}
+	defer f.Close()
+	return ReadBPE(f)
+}
+
+// ReadBPE reads a BPE vocabulary in tiktoken format
+func ReadBPE(r io.Reader) (*BPECounter, error) {
+	ranks := make(map[string]int)
+	h := fnv.New64a()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid vocab line %d", line)
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vocab token on line %d: %w", line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vocab rank on line %d: %w", line, err)
+		}
+		ranks[string(b)] = n
+		fmt.Fprintf(h, "%s %d\n", token, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vocab: %w", err)
+	}
+	return &BPECounter{ranks: ranks, key: fmt.Sprintf("bpe:%x", h.Sum64())}, nil
+}
+
+// CacheKey implements CacheKeyer; it identifies the vocabulary
+func (c *BPECounter) CacheKey() string {
+	return c.key
+}
+
+// CountTokens implements TokenCounter
+func (c *BPECounter) CountTokens(text string) int {
+	n := 0
+	for _, word := range bpePattern.FindAllString(text, -1) {
+		n += c.countWord(word)
+	}
+	return n
+}
+
+// countWord merges the bytes of a word by rank and returns the number of resulting tokens
+func (c *BPECounter) countWord(word string) int {
+	if _, ok := c.ranks[word]; ok {
+		return 1
+	}
+	parts := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		parts[i] = word[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := c.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts)
+}
@@ -0,0 +1,213 @@
+package aichat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// newMessageID returns a random message ID
+func newMessageID() string {
+	return newID("msg_")
+}
+
+// newID generates a random ID with the given prefix
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// Fork returns a new chat whose history is the messages before atIndex.
+// Messages are copied, so the fork can be changed without affecting the original chat;
+// the fork's Meta records its origin.
+// Hooks and middleware registered on the chat do not apply to the fork.
+func (chat *Chat) Fork(atIndex int) *Chat {
+	atIndex = max(0, min(atIndex, len(chat.Messages)))
+	messages := make([]*Message, atIndex)
+	for i, msg := range chat.Messages[:atIndex] {
+		messages[i] = msg.Clone()
+	}
+	fork := &Chat{
+		Messages: messages,
+		Created:  time.Now(),
+		Meta:     maps.Clone(chat.Meta),
+		Options:  chat.Options,
+	}
+	if fork.Meta == nil {
+		fork.Meta = make(map[string]any)
+	}
+	fork.Meta["forked_from"] = chat.ID
+	fork.Meta["fork_index"] = atIndex
+	fork.LastUpdated = fork.Created
+	return fork
+}
+
+// BranchAt starts a new branch before the message at index: the active branch is cut
+// to the messages before index and the following messages are kept as an inactive branch.
+// Messages added afterwards become alternatives to the message that was at index,
+// e.g. to edit and resend an earlier user message or retry an assistant reply.
+func (chat *Chat) BranchAt(index int) {
+	chat.ensureTree()
+	index = max(0, min(index, len(chat.Messages)))
+	previous, system := chat.Messages, chat.systemMessage()
+	chat.Messages = chat.Messages[:index:index]
+	chat.LastUpdated = time.Now()
+	chat.notifyChanged(previous, system)
+}
+
+// Branches returns the leaf message of every branch in the conversation tree, oldest first
+// by creation time.
+// A chat that has never branched has a single branch.
+func (chat *Chat) Branches() []*Message {
+	chat.ensureTree()
+	parents := make(map[string]bool)
+	for _, msg := range chat.tree {
+		parents[msg.ParentID] = true
+	}
+	var leaves []*Message
+	for _, msg := range chat.tree {
+		if !parents[msg.ID] {
+			leaves = append(leaves, msg)
+		}
+	}
+	slices.SortStableFunc(leaves, func(a, b *Message) int {
+		return a.Created.Compare(b.Created)
+	})
+	return leaves
+}
+
+// Children returns the alternative messages following the message with the given ID,
+// or the root messages of the tree if id is empty
+func (chat *Chat) Children(id string) []*Message {
+	chat.ensureTree()
+	var children []*Message
+	for _, msg := range chat.tree {
+		if msg.ParentID == id {
+			children = append(children, msg)
+		}
+	}
+	return children
+}
+
+// BranchPath returns the messages from the root of the tree to the message with the given ID
+func (chat *Chat) BranchPath(id string) ([]*Message, error) {
+	chat.ensureTree()
+	byID := make(map[string]*Message, len(chat.tree))
+	for _, msg := range chat.tree {
+		byID[msg.ID] = msg
+	}
+	var path []*Message
+	for id != "" {
+		msg, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("message %q not found", id)
+		}
+		if len(path) > len(chat.tree) {
+			return nil, fmt.Errorf("message %q has a cyclic parent chain", id)
+		}
+		path = append(path, msg)
+		id = msg.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// SwitchBranch makes the branch ending at the message with the given ID the active branch
+func (chat *Chat) SwitchBranch(id string) error {
+	path, err := chat.BranchPath(id)
+	if err != nil {
+		return err
+	}
+	previous, system := chat.Messages, chat.systemMessage()
+	chat.Messages = path
+	chat.LastUpdated = time.Now()
+	chat.notifyChanged(previous, system)
+	return nil
+}
+
+// ensureTree starts tracking the conversation tree and links the active branch into it
+func (chat *Chat) ensureTree() {
+	if chat.tree == nil {
+		chat.tree, chat.inTree = []*Message{}, nil
+	}
+	if chat.inTree == nil {
+		chat.inTree = make(map[*Message]bool, len(chat.tree))
+		for _, msg := range chat.tree {
+			chat.inTree[msg] = true
+		}
+	}
+	parent := ""
+	for _, msg := range chat.Messages {
+		if msg.ID == "" {
+			msg.ID = newMessageID()
+		}
+		msg.ParentID = parent
+		parent = msg.ID
+		if !chat.inTree[msg] {
+			chat.tree = append(chat.tree, msg)
+			chat.inTree[msg] = true
+		}
+	}
+}
+
+// linkMessages links the active branch into the tree, if the chat tracks one
+func (chat *Chat) linkMessages() {
+	if chat.tree != nil {
+		chat.ensureTree()
+	}
+}
+
+// forgetMessage removes a deleted message from the tree.
+// Its children are reparented to its parent so that inactive branches stay reachable.
+func (chat *Chat) forgetMessage(msg *Message) {
+	if msg == nil {
+		return
+	}
+	chat.replaceInTree(msg, msg.ParentID)
+}
+
+// replaceInTree removes a message from the tree and reparents its children to parent,
+// e.g. the ID of a message replacing it
+func (chat *Chat) replaceInTree(msg *Message, parent string) {
+	if chat.tree == nil || msg == nil {
+		return
+	}
+	i := slices.Index(chat.tree, msg)
+	if i < 0 {
+		return
+	}
+	chat.tree = slices.Delete(slices.Clone(chat.tree), i, i+1)
+	delete(chat.inTree, msg)
+	if msg.ID == "" || msg.ID == parent {
+		return
+	}
+	for _, m := range chat.tree {
+		if m.ParentID == msg.ID {
+			m.ParentID = parent
+		}
+	}
+}
+
+// inactiveMessages returns the tree messages that are not on the active branch
+func (chat *Chat) inactiveMessages() []*Message {
+	if chat.tree == nil {
+		return nil
+	}
+	active := make(map[*Message]bool, len(chat.Messages))
+	for _, msg := range chat.Messages {
+		active[msg] = true
+	}
+	var inactive []*Message
+	for _, msg := range chat.tree {
+		if !active[msg] {
+			inactive = append(inactive, msg)
+		}
+	}
+	return inactive
+}
@@ -0,0 +1,197 @@
+package aichat_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func contents(messages []*aichat.Message) []any {
+	out := make([]any, len(messages))
+	for i, msg := range messages {
+		out[i] = msg.Content
+	}
+	return out
+}
+
+func TestFork(t *testing.T) {
+	chat := &aichat.Chat{ID: "origin", Meta: map[string]any{"tenant": "acme"}}
+	chat.AddUserContent("question")
+	chat.AddAssistantContent("answer")
+	chat.AddUserContent("follow up")
+
+	fork := chat.Fork(2)
+	assert.Equal(t, []any{"question", "answer"}, contents(fork.Messages))
+	assert.NotSame(t, chat.Messages[0], fork.Messages[0])
+	assert.Equal(t, chat.Messages[0].ID, fork.Messages[0].ID)
+	assert.Equal(t, "origin", fork.Meta["forked_from"])
+	assert.Equal(t, 2, fork.Meta["fork_index"])
+	assert.Equal(t, "acme", fork.Meta["tenant"])
+
+	// The forks diverge independently
+	fork.AddUserContent("different follow up")
+	assert.Equal(t, []any{"question", "answer", "follow up"}, contents(chat.Messages))
+	assert.Equal(t, []any{"question", "answer", "different follow up"}, contents(fork.Messages))
+	_, ok := chat.Meta["forked_from"]
+	assert.False(t, ok)
+
+	// Branching the fork leaves the original tree untouched
+	fork.BranchAt(1)
+	fork.AddAssistantContent("other answer")
+	assert.Len(t, chat.Branches(), 1)
+	assert.Equal(t, chat.Messages[0].ID, chat.Messages[1].ParentID)
+
+	assert.Empty(t, new(aichat.Chat).Fork(5).Messages)
+	assert.Len(t, chat.Fork(-1).Messages, 0)
+}
+
+func TestBranches(t *testing.T) {
+	chat := new(aichat.Chat)
+	chat.SetSystemContent("system")
+	chat.AddUserContent("question")
+	first := chat.AddAssistantContent("first answer")
+
+	// A chat that has never branched has a single branch
+	assert.Equal(t, []*aichat.Message{first}, chat.Branches())
+
+	// Retry the assistant reply
+	chat.BranchAt(2)
+	second := chat.AddAssistantContent("second answer")
+	assert.Equal(t, []any{"system", "question", "second answer"}, contents(chat.Messages))
+	assert.Equal(t, []*aichat.Message{first, second}, chat.Branches())
+	assert.Equal(t, []*aichat.Message{first, second}, chat.Children(chat.Messages[1].ID))
+	assert.Equal(t, chat.Messages[1].ID, second.ParentID)
+
+	// Edit and resend the user message
+	chat.BranchAt(1)
+	chat.AddUserContent("edited question")
+	third := chat.AddAssistantContent("third answer")
+	assert.Len(t, chat.Branches(), 3)
+	assert.Len(t, chat.Children(chat.Messages[0].ID), 2)
+	assert.Len(t, chat.Children(""), 1)
+
+	// Switch back to an earlier branch
+	require.NoError(t, chat.SwitchBranch(first.ID))
+	assert.Equal(t, []any{"system", "question", "first answer"}, contents(chat.Messages))
+	chat.AddUserContent("continue first")
+	assert.Len(t, chat.Branches(), 3)
+
+	path, err := chat.BranchPath(third.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"system", "edited question", "third answer"}, contents(path))
+
+	assert.Error(t, chat.SwitchBranch("missing"))
+
+	// Popped messages are removed from the tree
+	chat.PopMessage()
+	assert.Equal(t, []*aichat.Message{first, second, third}, chat.Branches())
+
+	chat.ClearMessages()
+	assert.Empty(t, chat.Branches())
+}
+
+func TestBranchesSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	chat := &aichat.Chat{Options: aichat.Options{S3: s3}}
+	chat.AddUserContent("question")
+	first := chat.AddAssistantContent("first answer")
+	first.Meta().Set("model", "a")
+	chat.BranchAt(1)
+	chat.AddAssistantContent("second answer")
+	require.NoError(t, chat.Save(ctx, "tree"))
+
+	loaded := &aichat.Chat{Options: aichat.Options{S3: s3}}
+	require.NoError(t, loaded.Load(ctx, "tree"))
+	assert.Equal(t, []any{"question", "second answer"}, contents(loaded.Messages))
+	branches := loaded.Branches()
+	require.Len(t, branches, 2)
+	assert.Equal(t, first.ID, branches[0].ID, "branches are oldest first after a load")
+	assert.Equal(t, "a", branches[0].Meta().Get("model"))
+	assert.Equal(t, "second answer", branches[1].Content)
+
+	require.NoError(t, loaded.SwitchBranch(first.ID))
+	assert.Equal(t, []any{"question", "first answer"}, contents(loaded.Messages))
+
+	// IDs are not sent to LLMs
+	b, err := first.MarshalJSON()
+	require.NoError(t, err)
+	assert.Equal(t, `{"role":"assistant","content":"first answer"}`, string(b))
+}
+
+func TestBranchSystemMessage(t *testing.T) {
+	chat := new(aichat.Chat)
+	chat.AddUserContent("question")
+	chat.BranchAt(1)
+	chat.SetSystemContent("system")
+	chat.SetSystemContent("new system")
+	chat.ShiftMessages()
+	chat.UnshiftMessages(&aichat.Message{Role: "system", Content: "again"})
+	assert.Equal(t, []any{"again", "question"}, contents(chat.Messages))
+	leaves := chat.Branches()
+	require.Len(t, leaves, 1)
+	path, err := chat.BranchPath(leaves[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, chat.Messages, path)
+}
+
+func TestDeleteMessageKeepsBranches(t *testing.T) {
+	chat := new(aichat.Chat)
+	chat.AddUserContent("question")
+	answer := chat.AddAssistantContent("answer")
+	chat.AddUserContent("follow up")
+	chat.BranchAt(2)
+	chat.AddUserContent("other follow up")
+	oldLeaf := chat.Branches()[0]
+
+	// Children of a deleted message move to its parent
+	chat.DeleteMessage(answer.ID)
+	path, err := chat.BranchPath(oldLeaf.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"question", "follow up"}, contents(path))
+	assert.Len(t, chat.Children(chat.Messages[0].ID), 2)
+
+	// Children of a replaced message follow the replacement
+	replacement := chat.ReplaceMessage(chat.Messages[0].ID, &aichat.Message{ID: "new-question", Role: "user", Content: "new question"})
+	require.NotNil(t, replacement)
+	path, err = chat.BranchPath(oldLeaf.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"new question", "follow up"}, contents(path))
+}
+
+func TestCompactAndRepairKeepBranches(t *testing.T) {
+	ctx := context.Background()
+	chat := new(aichat.Chat)
+	chat.SetSystemContent("system")
+	chat.AddUserContent("question")
+	chat.AddAssistantContent("answer")
+	chat.AddUserContent("follow up")
+	chat.BranchAt(3)
+	chat.AddUserContent("other follow up")
+	chat.AddAssistantContent("other answer")
+	oldLeaf := chat.Branches()[0]
+
+	c := &aichat.Compactor{Summarize: summarizeRoles, KeepTokens: 1, DiscardOriginals: true}
+	ok, err := c.Compact(ctx, chat)
+	require.NoError(t, err)
+	require.True(t, ok)
+	path, err := chat.BranchPath(oldLeaf.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"system", "follow up"}, contents(path))
+
+	chat = new(aichat.Chat)
+	chat.AddUserContent("hello")
+	chat.AddUserContent("anyone there?")
+	chat.AddAssistantContent("hi")
+	chat.BranchAt(2)
+	chat.AddAssistantContent("hey")
+	oldLeaf = chat.Branches()[0]
+	assert.Empty(t, chat.Repair(aichat.DefaultRepairPolicy))
+	path, err = chat.BranchPath(oldLeaf.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"hello\n\nanyone there?", "hi"}, contents(path))
+}
@@ -8,8 +8,22 @@ import (
 
 // Options contains configuration options for Chat sessions.
 // S3 provides storage capabilities for persisting chat sessions.
+// Attachments, if set, moves inline binary content out of saved chats.
+// TokenCounter is used by TokenCount (default ApproxCounter).
+// Prices, if set, prices message usage that has no provider-reported cost.
+// Telemetry, if set, traces tool calls run by RangePendingToolCalls.
+// Logging, if set, logs tool calls and Load/Save timings.
+// Templates provides the prompt templates of SetSystemTemplate and AddUserTemplate.
+// Prompts provides the versioned prompts of SetSystemPrompt.
 type Options struct {
-	S3 S3
+	S3           S3
+	Attachments  *AttachmentStore
+	TokenCounter TokenCounter
+	Prices       PriceTable
+	Telemetry    *Telemetry
+	Logging      *Logging
+	Templates    *Templates
+	Prompts      *PromptRegistry
 }
 
 // Chat represents a chat session with message history
@@ -28,33 +42,58 @@ type Chat struct {
 	Meta map[string]any `json:"meta,omitempty"`
 	// Options contains the configuration for these chat sessions
 	Options Options `json:"-"`
+
+	// tree holds every message of a branching conversation, including inactive branches
+	tree []*Message
+	// inTree is the set of messages in tree, rebuilt by ensureTree when nil
+	inTree map[*Message]bool
+	// hooks holds registered middleware and observers
+	hooks *chatHooks
 }
 
-// AddMessage adds a message to the chat
+// AddMessage adds a message to the chat.
+// It assigns the message an ID and creation time if they are not set.
+// Registered middleware may transform or veto the message.
 func (chat *Chat) AddMessage(message *Message) {
-	if message == nil {
-		return
+	chat.addMessage(message)
+}
+
+// addMessage adds a message and returns the message added after middleware, or nil if vetoed
+func (chat *Chat) addMessage(message *Message) *Message {
+	if message = chat.admit(message); message == nil {
+		return nil
 	}
+	system := chat.systemMessage()
+	message.ensureID()
 	chat.Messages = append(chat.Messages, message)
+	chat.linkMessages()
 	chat.LastUpdated = time.Now()
+	chat.notifyAdded(message)
+	chat.notifySystem(system)
+	return message
 }
 
-// AddMessageOnce adds a message to the chat (idempotent)
+// AddMessageOnce adds a message to the chat (idempotent).
+// A message is already present if it is the same pointer or has the same ID,
+// so it also holds for messages restored by Load.
 func (chat *Chat) AddMessageOnce(message *Message) {
-	if slices.Contains(chat.Messages, message) {
+	if message == nil || slices.Contains(chat.Messages, message) {
+		return
+	}
+	if message.ID != "" && chat.MessageByID(message.ID) != nil {
 		return
 	}
 	chat.AddMessage(message)
 }
 
-// AddRoleContent adds a role and content to the chat
+// AddRoleContent adds a role and content to the chat.
+// It returns the added message, or nil if middleware vetoed it.
 func (chat *Chat) AddRoleContent(role string, content any) *Message {
 	m := &Message{
 		Role:    role,
 		Content: content,
 	}
-	chat.AddMessage(m)
-	return m
+	return chat.addMessage(m)
 }
 
 // AddUserContent adds a user message to the chat
@@ -75,8 +114,7 @@ func (chat *Chat) AddToolRawContent(name string, toolCallID string, content any)
 		ToolCallID: toolCallID,
 		Content:    content,
 	}
-	chat.AddMessage(m)
-	return m
+	return chat.addMessage(m)
 }
 
 // AddToolContent adds a tool content to the chat
@@ -102,14 +140,17 @@ func (chat *Chat) AddAssistantToolCall(toolCalls []ToolCall) *Message {
 		Role:      "assistant",
 		ToolCalls: toolCalls,
 	}
-	chat.AddMessage(m)
-	return m
+	return chat.addMessage(m)
 }
 
 // ClearMessages removes all messages from the chat
 func (chat *Chat) ClearMessages() {
+	removed, system := chat.Messages, chat.systemMessage()
 	chat.Messages = []*Message{}
+	chat.tree, chat.inTree = nil, nil
 	chat.LastUpdated = time.Now()
+	chat.notifyRemoved(removed...)
+	chat.notifySystem(system)
 }
 
 // LastMessage returns the last message in the chat
@@ -156,6 +197,75 @@ func (chat *Chat) LastMessageRole() string {
 	return msg.Role
 }
 
+// MessageByID returns the message with the given ID, or nil if there is none
+func (chat *Chat) MessageByID(id string) *Message {
+	if id == "" {
+		return nil
+	}
+	for _, msg := range chat.Messages {
+		if msg.ID == id {
+			return msg
+		}
+	}
+	return nil
+}
+
+// MessageIndex returns the index of the message with the given ID, or -1 if there is none
+func (chat *Chat) MessageIndex(id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, msg := range chat.Messages {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ReplaceMessage replaces the message with the given ID and returns the replaced message,
+// or nil if there is none or middleware vetoed the new message.
+// The new message keeps the ID unless it has its own.
+func (chat *Chat) ReplaceMessage(id string, msg *Message) *Message {
+	i := chat.MessageIndex(id)
+	if i < 0 || msg == nil {
+		return nil
+	}
+	old := chat.Messages[i]
+	if msg = chat.admit(msg); msg == nil {
+		return nil
+	}
+	system := chat.systemMessage()
+	if msg.ID == "" {
+		msg.ID = id
+	}
+	msg.ensureID()
+	chat.replaceInTree(old, msg.ID)
+	chat.Messages[i] = msg
+	chat.linkMessages()
+	chat.LastUpdated = time.Now()
+	chat.notifyRemoved(old)
+	chat.notifyAdded(msg)
+	chat.notifySystem(system)
+	return old
+}
+
+// DeleteMessage removes the message with the given ID and returns it, or nil if there is none
+func (chat *Chat) DeleteMessage(id string) *Message {
+	i := chat.MessageIndex(id)
+	if i < 0 {
+		return nil
+	}
+	msg, system := chat.Messages[i], chat.systemMessage()
+	chat.Messages = slices.Delete(slices.Clone(chat.Messages), i, i+1)
+	chat.forgetMessage(msg)
+	chat.linkMessages()
+	chat.LastUpdated = time.Now()
+	chat.notifyRemoved(msg)
+	chat.notifySystem(system)
+	return msg
+}
+
 // MessageCount returns the total number of messages in the chat
 func (chat *Chat) MessageCount() int {
 	return len(chat.Messages)
@@ -178,8 +288,11 @@ func (chat *Chat) PopMessage() *Message {
 		return nil
 	}
 	chat.LastUpdated = time.Now()
-	msg := chat.Messages[len(chat.Messages)-1]
+	msg, system := chat.Messages[len(chat.Messages)-1], chat.systemMessage()
 	chat.Messages = chat.Messages[:len(chat.Messages)-1]
+	chat.forgetMessage(msg)
+	chat.notifyRemoved(msg)
+	chat.notifySystem(system)
 	return msg
 }
 
@@ -190,8 +303,12 @@ func (chat *Chat) PopMessageIfRole(role string) *Message {
 	}
 	msg := chat.Messages[len(chat.Messages)-1]
 	if msg.Role == role {
+		system := chat.systemMessage()
 		chat.LastUpdated = time.Now()
 		chat.Messages = chat.Messages[:len(chat.Messages)-1]
+		chat.forgetMessage(msg)
+		chat.notifyRemoved(msg)
+		chat.notifySystem(system)
 		return msg
 	}
 	return nil
@@ -235,14 +352,28 @@ func (chat *Chat) SetSystemContent(content any) *Message {
 	return chat.SetSystemMessage(m)
 }
 
-// SetSystemMessage sets the system message at the beginning of the chat
+// SetSystemMessage sets the system message at the beginning of the chat.
+// It returns the system message, or nil if middleware vetoed it.
 func (chat *Chat) SetSystemMessage(msg *Message) *Message {
-	if len(chat.Messages) > 0 && chat.Messages[0].Role == "system" {
+	if msg = chat.admit(msg); msg == nil {
+		return nil
+	}
+	if old := chat.systemMessage(); old != nil {
+		if old == msg {
+			// Already the system message; nothing changes
+			return msg
+		}
+		msg.ensureID()
+		chat.replaceInTree(old, msg.ID)
 		chat.Messages[0] = msg
-	} else {
-		chat.UnshiftMessages(msg)
+		chat.linkMessages()
+		chat.LastUpdated = time.Now()
+		chat.notifyRemoved(old)
+		chat.notifyAdded(msg)
+		chat.notifySystem(old)
+		return msg
 	}
-	chat.LastUpdated = time.Now()
+	chat.unshiftMessage(msg)
 	return msg
 }
 
@@ -252,17 +383,33 @@ func (chat *Chat) ShiftMessages() *Message {
 		return nil
 	}
 	chat.LastUpdated = time.Now()
-	msg := chat.Messages[0]
+	msg, system := chat.Messages[0], chat.systemMessage()
 	chat.Messages = chat.Messages[1:]
+	chat.forgetMessage(msg)
+	chat.notifyRemoved(msg)
+	chat.notifySystem(system)
 	return msg
 }
 
-// UnshiftMessages unshifts all messages to the right by one index
+// UnshiftMessages unshifts all messages to the right by one index.
+// Registered middleware may transform or veto the message.
 func (chat *Chat) UnshiftMessages(msg *Message) {
+	if msg = chat.admit(msg); msg != nil {
+		chat.unshiftMessage(msg)
+	}
+}
+
+// unshiftMessage inserts an admitted message at the beginning of the chat
+func (chat *Chat) unshiftMessage(msg *Message) {
+	system := chat.systemMessage()
+	msg.ensureID()
 	chat.LastUpdated = time.Now()
 	if len(chat.Messages) == 0 {
 		chat.Messages = []*Message{msg}
 	} else {
 		chat.Messages = append([]*Message{msg}, chat.Messages...)
 	}
+	chat.linkMessages()
+	chat.notifyAdded(msg)
+	chat.notifySystem(system)
 }
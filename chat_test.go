@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/presbrey/aichat"
 )
@@ -306,3 +308,68 @@ func TestRangeByRole(t *testing.T) {
 		t.Error("Expected error to be propagated")
 	}
 }
+
+func TestMessageIDs(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	chat := &aichat.Chat{Options: aichat.Options{S3: s3}}
+
+	before := time.Now()
+	question := chat.AddUserContent("question")
+	answer := chat.AddAssistantContent("answer")
+	assert.NotEmpty(t, question.ID)
+	assert.NotEqual(t, question.ID, answer.ID)
+	assert.False(t, question.Created.Before(before))
+
+	// Existing IDs and timestamps are kept
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := &aichat.Message{ID: "fixed", Created: created, Role: "user", Content: "again"}
+	chat.AddMessageOnce(msg)
+	assert.Equal(t, "fixed", msg.ID)
+	assert.Equal(t, created, msg.Created)
+	assert.Same(t, answer, chat.MessageByID(answer.ID))
+	assert.Nil(t, chat.MessageByID("missing"))
+	assert.Nil(t, chat.MessageByID(""))
+
+	// AddMessageOnce is idempotent by ID across a save/load round trip
+	require.NoError(t, chat.Save(ctx, "ids"))
+	loaded := &aichat.Chat{Options: aichat.Options{S3: s3}}
+	require.NoError(t, loaded.Load(ctx, "ids"))
+	require.Len(t, loaded.Messages, 3)
+	assert.Equal(t, question.ID, loaded.Messages[0].ID)
+	assert.True(t, question.Created.Equal(loaded.Messages[0].Created))
+	assert.Equal(t, created, loaded.Messages[2].Created.UTC())
+	loaded.AddMessageOnce(&aichat.Message{ID: "fixed", Role: "user", Content: "again"})
+	assert.Len(t, loaded.Messages, 3)
+
+	// ReplaceMessage keeps the ID and position
+	edited := &aichat.Message{Role: "assistant", Content: "better answer"}
+	assert.Same(t, answer, chat.ReplaceMessage(answer.ID, edited))
+	assert.Equal(t, answer.ID, edited.ID)
+	assert.False(t, edited.Created.IsZero())
+	assert.Same(t, edited, chat.Messages[1])
+	assert.Nil(t, chat.ReplaceMessage("missing", edited))
+	assert.Nil(t, chat.ReplaceMessage(answer.ID, nil))
+
+	// DeleteMessage removes the message
+	assert.Same(t, question, chat.DeleteMessage(question.ID))
+	assert.Nil(t, chat.DeleteMessage(question.ID))
+	assert.Equal(t, []*aichat.Message{edited, msg}, chat.Messages)
+
+	// IDs and timestamps are not sent to LLMs
+	b, err := json.Marshal(msg)
+	require.NoError(t, err)
+	assert.Equal(t, `{"role":"user","content":"again"}`, string(b))
+}
+
+func TestDeleteMessageBranches(t *testing.T) {
+	chat := new(aichat.Chat)
+	chat.AddUserContent("question")
+	first := chat.AddAssistantContent("first answer")
+	chat.BranchAt(1)
+	second := chat.AddAssistantContent("second answer")
+	assert.Len(t, chat.Branches(), 2)
+
+	chat.DeleteMessage(second.ID)
+	assert.Equal(t, []*aichat.Message{first}, chat.Branches())
+}
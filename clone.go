@@ -0,0 +1,253 @@
+package aichat
+
+import (
+	"iter"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Clone returns a deep copy of the chat: messages, content parts, tool calls, reasoning,
+// and chat and message meta are copied, so the clone can be modified or handed to another
+// goroutine without aliasing the original. Inactive branches are copied along with the
+// active one. Options are shared; hooks and middleware are not copied, since they may not
+// be safe to call from another goroutine, and can be registered again on the clone.
+//
+// Content and meta values are copied if they are strings, parts, or JSON-like maps and
+// slices (map[string]any, []any); values of other types are shared and should be treated
+// as immutable.
+func (chat *Chat) Clone() *Chat {
+	clone := &Chat{
+		ID:          chat.ID,
+		Key:         chat.Key,
+		Created:     chat.Created,
+		LastUpdated: chat.LastUpdated,
+		Meta:        cloneMap(chat.Meta),
+		Options:     chat.Options,
+	}
+	copies := make(map[*Message]*Message, len(chat.Messages))
+	cloneOnce := func(msg *Message) *Message {
+		if c, ok := copies[msg]; ok {
+			return c
+		}
+		c := msg.Clone()
+		copies[msg] = c
+		return c
+	}
+	if chat.Messages != nil {
+		clone.Messages = make([]*Message, len(chat.Messages))
+		for i, msg := range chat.Messages {
+			clone.Messages[i] = cloneOnce(msg)
+		}
+	}
+	if chat.tree != nil {
+		clone.tree = make([]*Message, len(chat.tree))
+		for i, msg := range chat.tree {
+			clone.tree[i] = cloneOnce(msg)
+		}
+	}
+	return clone
+}
+
+// Clone returns a deep copy of the message, including its content parts, tool calls,
+// reasoning details and meta. See Chat.Clone for how content values are copied.
+func (m *Message) Clone() *Message {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	c.Content = cloneValue(m.Content)
+	c.ToolCalls = cloneToolCalls(m.ToolCalls)
+	c.ReasoningDetails = slices.Clone(m.ReasoningDetails)
+	c.meta = cloneMap(m.meta)
+	return &c
+}
+
+func cloneToolCalls(calls []ToolCall) []ToolCall {
+	if calls == nil {
+		return nil
+	}
+	out := make([]ToolCall, len(calls))
+	for i, call := range calls {
+		call.Function.Parameters.Properties = maps.Clone(call.Function.Parameters.Properties)
+		call.Function.Parameters.Required = slices.Clone(call.Function.Parameters.Required)
+		out[i] = call
+	}
+	return out
+}
+
+// clonePart returns a deep copy of a content part
+func clonePart(p *Part) *Part {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	if p.ImageURL != nil {
+		v := *p.ImageURL
+		c.ImageURL = &v
+	}
+	if p.InputAudio != nil {
+		v := *p.InputAudio
+		c.InputAudio = &v
+	}
+	if p.File != nil {
+		v := *p.File
+		c.File = &v
+	}
+	if p.VideoURL != nil {
+		v := *p.VideoURL
+		c.VideoURL = &v
+	}
+	if p.ToolResult != nil {
+		v := *p.ToolResult
+		v.Content = cloneValue(p.ToolResult.Content)
+		c.ToolResult = &v
+	}
+	if p.Attachment != nil {
+		v := *p.Attachment
+		c.Attachment = &v
+	}
+	return &c
+}
+
+// cloneValue deep-copies content and meta values of known types
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case []*Part:
+		if v == nil {
+			return v
+		}
+		out := make([]*Part, len(v))
+		for i, p := range v {
+			out[i] = clonePart(p)
+		}
+		return out
+	case []Part:
+		if v == nil {
+			return v
+		}
+		out := make([]Part, len(v))
+		for i := range v {
+			out[i] = *clonePart(&v[i])
+		}
+		return out
+	case map[string]any:
+		return cloneMap(v)
+	case []any:
+		if v == nil {
+			return v
+		}
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = cloneValue(e)
+		}
+		return out
+	case []string:
+		return slices.Clone(v)
+	case map[string]string:
+		return maps.Clone(v)
+	case *Usage:
+		if v == nil {
+			return v
+		}
+		c := *v
+		return &c
+	case *TemplateInfo:
+		if v == nil {
+			return v
+		}
+		c := *v
+		c.Vars = cloneValue(v.Vars)
+		return &c
+	case TemplateInfo:
+		v.Vars = cloneValue(v.Vars)
+		return v
+	}
+	return v
+}
+
+func cloneMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+// Snapshot is an immutable view of a chat at a point in time. It holds a private deep copy
+// of the chat and returns copies from its accessors, so it is safe for concurrent readers
+// while the original chat keeps changing.
+type Snapshot struct {
+	chat *Chat
+}
+
+// Snapshot returns an immutable view of the chat as it is now
+func (chat *Chat) Snapshot() *Snapshot {
+	return &Snapshot{chat: chat.Clone()}
+}
+
+// ID returns the chat ID
+func (s *Snapshot) ID() string {
+	return s.chat.ID
+}
+
+// LastUpdated returns the time of the last change to the chat before the snapshot
+func (s *Snapshot) LastUpdated() time.Time {
+	return s.chat.LastUpdated
+}
+
+// Len returns the number of messages
+func (s *Snapshot) Len() int {
+	return len(s.chat.Messages)
+}
+
+// Message returns a copy of the message at index i, or nil if i is out of range
+func (s *Snapshot) Message(i int) *Message {
+	if i < 0 || i >= len(s.chat.Messages) {
+		return nil
+	}
+	return s.chat.Messages[i].Clone()
+}
+
+// LastMessage returns a copy of the last message, or nil
+func (s *Snapshot) LastMessage() *Message {
+	return s.Message(len(s.chat.Messages) - 1)
+}
+
+// Messages returns copies of the messages
+func (s *Snapshot) Messages() []*Message {
+	out := make([]*Message, len(s.chat.Messages))
+	for i, msg := range s.chat.Messages {
+		out[i] = msg.Clone()
+	}
+	return out
+}
+
+// All returns an iterator over copies of the messages and their indexes
+func (s *Snapshot) All() iter.Seq2[int, *Message] {
+	return func(yield func(int, *Message) bool) {
+		for i, msg := range s.chat.Messages {
+			if !yield(i, msg.Clone()) {
+				return
+			}
+		}
+	}
+}
+
+// Meta returns a copy of the chat meta value for key
+func (s *Snapshot) Meta(key string) any {
+	return cloneValue(s.chat.Meta[key])
+}
+
+// Chat returns a mutable deep copy of the snapshot
+func (s *Snapshot) Chat() *Chat {
+	return s.chat.Clone()
+}
+
+// CompletionRequest returns a request for copies of the snapshot messages and meta
+func (s *Snapshot) CompletionRequest(model string, tools ...*Tool) *CompletionRequest {
+	return s.Chat().CompletionRequest(model, tools...)
+}
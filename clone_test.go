@@ -0,0 +1,133 @@
+package aichat_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestCloneIsDeep(t *testing.T) {
+	chat := &aichat.Chat{ID: "chat-1", Meta: map[string]any{"tags": []any{"a"}, "user": map[string]any{"name": "ann"}}}
+	chat.SetSystemContent("be brief")
+	user := chat.AddUserContent([]*aichat.Part{aichat.TextPart("look"), aichat.ImagePart("https://example.com/a.png")})
+	user.Meta().Set("source", map[string]any{"app": "web"})
+	call := chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1")})
+	chat.AddToolRawContent("get_weather", "call_1", "sunny")
+
+	clone := chat.Clone()
+	require.Len(t, clone.Messages, len(chat.Messages))
+	assert.Equal(t, chat.ID, clone.ID)
+	assert.Equal(t, chat.Meta, clone.Meta)
+	for i, msg := range clone.Messages {
+		assert.NotSame(t, chat.Messages[i], msg)
+		assert.Equal(t, chat.Messages[i].ID, msg.ID)
+		assert.Equal(t, chat.Messages[i].Content, msg.Content)
+	}
+
+	// Mutating the clone leaves the original untouched
+	parts, err := clone.Messages[1].ContentParts()
+	require.NoError(t, err)
+	parts[0].Text = "changed"
+	parts[1].ImageURL.URL = "https://example.com/b.png"
+	clone.Messages[1].Meta().Get("source").(map[string]any)["app"] = "cli"
+	clone.Messages[2].ToolCalls[0].Function.Arguments = `{"city":"Paris"}`
+	clone.Meta["tags"].([]any)[0] = "b"
+	clone.Meta["user"].(map[string]any)["name"] = "bob"
+	clone.AddUserContent("more")
+
+	parts, err = user.ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, "look", parts[0].Text)
+	assert.Equal(t, "https://example.com/a.png", parts[1].ImageURL.URL)
+	assert.Equal(t, map[string]any{"app": "web"}, user.Meta().Get("source"))
+	assert.Equal(t, "{}", call.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, []any{"a"}, chat.Meta["tags"])
+	assert.Equal(t, map[string]any{"name": "ann"}, chat.Meta["user"])
+	assert.Len(t, chat.Messages, 4)
+}
+
+func TestCloneKeepsBranchesWithoutHooks(t *testing.T) {
+	chat := &aichat.Chat{}
+	var added int
+	chat.OnMessageAdded(func(*aichat.Chat, *aichat.Message) { added++ })
+	chat.AddUserContent("hello")
+	chat.AddAssistantContent("hi")
+	chat.BranchAt(1)
+	chat.AddAssistantContent("hey")
+
+	clone := chat.Clone()
+	assert.Len(t, clone.Branches(), 2)
+	require.Len(t, clone.Children(clone.Messages[0].ID), 2)
+	assert.Same(t, clone.Messages[1], clone.Children(clone.Messages[0].ID)[1],
+		"the tree shares messages with the active branch")
+
+	clone.AddAssistantContent("again")
+	assert.Equal(t, 3, added, "hooks do not carry over to the clone")
+	assert.Len(t, chat.Messages, 2)
+}
+
+func TestSnapshot(t *testing.T) {
+	chat := &aichat.Chat{ID: "chat-1", Meta: map[string]any{"topic": "weather"}}
+	chat.AddUserContent("hello")
+	chat.AddAssistantContent("hi")
+
+	snap := chat.Snapshot()
+	chat.AddUserContent("still there?")
+	chat.Messages[0].Content = "changed"
+	chat.Meta["topic"] = "news"
+
+	assert.Equal(t, "chat-1", snap.ID())
+	assert.Equal(t, 2, snap.Len())
+	assert.Equal(t, "hello", snap.Message(0).Content)
+	assert.Equal(t, "hi", snap.LastMessage().Content)
+	assert.Nil(t, snap.Message(2))
+	assert.Equal(t, "weather", snap.Meta("topic"))
+
+	// Accessors return copies
+	snap.Message(0).Content = "mutated"
+	snap.Messages()[1].Content = "mutated"
+	for _, msg := range snap.All() {
+		msg.Content = "mutated"
+	}
+	assert.Equal(t, "hello", snap.Message(0).Content)
+	assert.Equal(t, "hi", snap.Message(1).Content)
+
+	req := snap.CompletionRequest("model")
+	require.Len(t, req.Messages, 2)
+	assert.Equal(t, "weather", req.Meta["topic"])
+
+	restored := snap.Chat()
+	restored.AddUserContent("again")
+	assert.Equal(t, 2, snap.Len())
+}
+
+func TestSnapshotConcurrentReaders(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.AddUserContent("hello")
+	chat.AddAssistantContent("hi")
+	snap := chat.Snapshot()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, msg := range snap.All() {
+					msg.Meta().Set("seen", j)
+				}
+				_ = snap.CompletionRequest("model")
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		chat.AddUserContent("more")
+		chat.Messages[0].Meta().Set("seen", i)
+	}
+	wg.Wait()
+	assert.Equal(t, 2, snap.Len())
+}
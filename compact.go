@@ -0,0 +1,236 @@
+package aichat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetaCompaction is the message meta key tagging summary messages created by a Compactor.
+// Its value records the number of summarized messages and the storage key of their archive.
+const MetaCompaction = "compaction"
+
+// SummarizeFunc summarizes messages into a single text, typically by calling a model
+type SummarizeFunc func(ctx context.Context, messages []*Message) (string, error)
+
+// DefaultSummaryPrompt is the default instruction asking Compactor.Client for a summary
+const DefaultSummaryPrompt = "Summarize the conversation above for your own future reference. " +
+	"Keep the facts, decisions, open questions and tool results needed to continue it. Reply with the summary only."
+
+// Compactor replaces older turns of a chat with a model-generated summary
+type Compactor struct {
+	// Summarize produces the summary of the compacted messages.
+	// If it is nil, the summary is requested from Client.
+	Summarize SummarizeFunc
+	// Client is asked for the summary when Summarize is nil, with the compacted messages
+	// followed by a user message with Prompt
+	Client Completer
+	// Model is the model of summary requests sent to Client
+	Model string
+	// Prompt is the instruction of summary requests sent to Client (default DefaultSummaryPrompt)
+	Prompt string
+	// MaxTokens triggers compaction when the chat token count exceeds it (0 always compacts)
+	MaxTokens int
+	// KeepTokens is the token budget of recent messages kept verbatim.
+	// The last message and its tool call group are always kept.
+	KeepTokens int
+	// Role is the role of the summary message. By default the summary is a user message,
+	// merged into the first kept message when that is a user message too, so that roles
+	// keep alternating.
+	Role string
+	// Prefix is prepended to the summary text
+	Prefix string
+	// ArchiveKey returns the storage key for the compacted messages
+	// (default "<chat key or ID>/compacted/<unix nanoseconds>", with a generated ID
+	// when the chat has neither)
+	ArchiveKey func(chat *Chat) string
+	// DiscardOriginals allows compacting a chat without S3 storage, dropping the
+	// summarized messages instead of archiving them
+	DiscardOriginals bool
+}
+
+// Compact summarizes a prefix of the chat messages, after any leading system messages,
+// and replaces it with a single summary message. The original messages are archived in the
+// chat's S3 storage and can be recovered with LoadCompacted; without storage Compact fails
+// unless DiscardOriginals is set. Observers of the chat are notified of the removed messages
+// and the summary; middleware does not run. It reports whether the chat was compacted.
+func (c *Compactor) Compact(ctx context.Context, chat *Chat) (bool, error) {
+	if c.MaxTokens > 0 && chat.TokenCount() <= c.MaxTokens {
+		return false, nil
+	}
+
+	start := 0
+	for start < len(chat.Messages) && chat.Messages[start].Role == "system" {
+		start++
+	}
+	cut := c.cut(chat, start)
+	if cut <= start {
+		return false, nil
+	}
+	prefix := chat.Messages[start:cut]
+	if chat.Options.S3 == nil && !c.DiscardOriginals {
+		return false, fmt.Errorf("s3 storage not initialized; set DiscardOriginals to compact without an archive")
+	}
+
+	summary, err := c.summarize(ctx, prefix)
+	if err != nil {
+		return false, fmt.Errorf("failed to summarize messages: %w", err)
+	}
+
+	tag := map[string]any{
+		"messages": len(prefix),
+		"created":  time.Now().UTC().Format(time.RFC3339),
+	}
+	if usages := messageUsages(prefix); len(usages) > 0 {
+		// Keep the usage of the replaced messages so that Chat.Usage still accounts for it
+		tag["usage"] = usages
+	}
+	if chat.Options.S3 != nil {
+		key := c.archiveKey(chat)
+		archived := prefix
+		if store := chat.Options.Attachments; store != nil {
+			if archived, err = store.Externalize(ctx, prefix); err != nil {
+				return false, fmt.Errorf("failed to store attachments: %w", err)
+			}
+		}
+		data, err := json.Marshal(toS3Messages(archived))
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal compacted messages: %w", err)
+		}
+		if err := chat.Options.S3.Put(ctx, key, bytes.NewReader(data)); err != nil {
+			return false, fmt.Errorf("failed to archive compacted messages: %w", err)
+		}
+		tag["archive"] = key
+	}
+
+	role := c.Role
+	if role == "" {
+		role = "user"
+	}
+	msg := &Message{Role: role, Content: c.Prefix + summary}
+	kept := chat.Messages[cut:]
+	if next := kept[0]; c.Role == "" && next.Role == "user" {
+		// Prepend the summary to the next user turn rather than adding a second user message
+		merged := next.shallowCopy()
+		merged.Content = mergeMessages(msg, next).Content
+		chat.replaceInTree(next, merged.ID)
+		msg, kept = merged, kept[1:]
+	}
+	msg.ensureID()
+	msg.Meta().Set(MetaCompaction, tag)
+
+	messages := make([]*Message, 0, start+1+len(kept))
+	messages = append(messages, chat.Messages[:start]...)
+	messages = append(messages, msg)
+	messages = append(messages, kept...)
+	for _, m := range prefix {
+		chat.forgetMessage(m)
+	}
+	previous, system := chat.Messages, chat.systemMessage()
+	chat.Messages = messages
+	chat.linkMessages()
+	chat.LastUpdated = time.Now()
+	chat.notifyChanged(previous, system)
+	return true, nil
+}
+
+// summarize summarizes messages with Summarize or Client
+func (c *Compactor) summarize(ctx context.Context, messages []*Message) (string, error) {
+	if c.Summarize != nil {
+		return c.Summarize(ctx, messages)
+	}
+	if c.Client == nil {
+		return "", fmt.Errorf("compactor has no Summarize function or Client")
+	}
+	prompt := c.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	req := &CompletionRequest{
+		Model:    c.Model,
+		Messages: append(slices.Clone(messages), &Message{Role: "user", Content: prompt}),
+	}
+	resp, err := c.Client.Complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	var summary string
+	if resp != nil {
+		summary = strings.TrimSpace(resp.ContentString())
+	}
+	if summary == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return summary, nil
+}
+
+// cut returns the index of the first message kept verbatim.
+// It only cuts between tool call groups so that calls and results stay together.
+func (c *Compactor) cut(chat *Chat, start int) int {
+	messages := chat.Messages
+	counter := chat.tokenCounter()
+	groups := groupToolCalls(messages)
+	first := make(map[int]int)
+	for i := len(messages) - 1; i >= 0; i-- {
+		first[groups[i]] = i
+	}
+
+	cut := start
+	tokens := 0
+	minFirst := len(messages)
+	for i := len(messages) - 1; i > start; i-- {
+		tokens += messages[i].TokenCount(counter)
+		minFirst = min(minFirst, first[groups[i]])
+		if minFirst < i {
+			continue
+		}
+		if tokens > c.KeepTokens && cut > start {
+			break
+		}
+		cut = i
+	}
+	return cut
+}
+
+func (c *Compactor) archiveKey(chat *Chat) string {
+	if c.ArchiveKey != nil {
+		return c.ArchiveKey(chat)
+	}
+	base := chat.Key
+	if base == "" {
+		base = chat.ID
+	}
+	if base == "" {
+		base = newID("chat_")
+	}
+	return base + "/compacted/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// LoadCompacted loads the original messages replaced by a summary message
+func (chat *Chat) LoadCompacted(ctx context.Context, summary *Message) ([]*Message, error) {
+	tag, _ := summary.Meta().Get(MetaCompaction).(map[string]any)
+	key, _ := tag["archive"].(string)
+	if key == "" {
+		return nil, fmt.Errorf("message has no compaction archive")
+	}
+	if chat.Options.S3 == nil {
+		return nil, fmt.Errorf("s3 storage not initialized")
+	}
+
+	reader, err := chat.Options.S3.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get compacted messages from storage: %w", err)
+	}
+	defer reader.Close()
+
+	var s3messages []*s3message
+	if err := json.NewDecoder(reader).Decode(&s3messages); err != nil {
+		return nil, fmt.Errorf("failed to decode compacted messages: %w", err)
+	}
+	return fromS3Messages(s3messages), nil
+}
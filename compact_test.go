@@ -0,0 +1,160 @@
+package aichat_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func summarizeRoles(ctx context.Context, messages []*aichat.Message) (string, error) {
+	return fmt.Sprintf("%d messages: %v", len(messages), roles(messages)), nil
+}
+
+func TestCompactor(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	chat := newToolChat()
+	chat.ID = "compact-id"
+	chat.Options.S3 = s3
+	original := append([]*aichat.Message{}, chat.Messages...)
+	original[2].Meta().Set("model", "test")
+
+	c := &aichat.Compactor{
+		Summarize:  summarizeRoles,
+		KeepTokens: 20,
+		Prefix:     "Summary: ",
+		ArchiveKey: func(chat *aichat.Chat) string { return chat.ID + "/archive" },
+	}
+	ok, err := c.Compact(ctx, chat)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The tool call group is summarized together with the first turn,
+	// and the summary is merged into the next user turn
+	assert.Equal(t, []string{"system", "user", "assistant"}, roles(chat.Messages))
+	summary := chat.Messages[1]
+	assert.Equal(t, "Summary: 4 messages: [user assistant tool assistant]\n\nsecond question", summary.Content)
+	assert.Equal(t, original[5].ID, summary.ID)
+	assert.Empty(t, chat.Validate())
+	tag, ok := summary.Meta().Get(aichat.MetaCompaction).(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, 4, tag["messages"])
+	assert.Equal(t, "compact-id/archive", tag["archive"])
+
+	// The original messages are recoverable, also after a save/load round trip
+	require.NoError(t, chat.Save(ctx, "compact-key"))
+	loaded, err := aichat.NewStorage(chat.Options).Load(ctx, "compact-key")
+	require.NoError(t, err)
+	archived, err := loaded.LoadCompacted(ctx, loaded.Messages[1])
+	require.NoError(t, err)
+	require.Len(t, archived, 4)
+	for i, msg := range archived {
+		assert.Equal(t, original[i+1].Role, msg.Role)
+		assert.Equal(t, original[i+1].Content, msg.Content)
+	}
+	assert.Equal(t, "call-1", archived[1].ToolCalls[0].ID)
+	assert.Equal(t, "test", archived[1].Meta().Get("model"))
+}
+
+func TestCompactorThreshold(t *testing.T) {
+	ctx := context.Background()
+	chat := newToolChat()
+	c := &aichat.Compactor{Summarize: summarizeRoles, MaxTokens: chat.TokenCount(), DiscardOriginals: true}
+
+	ok, err := c.Compact(ctx, chat)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 7, chat.MessageCount())
+
+	// Without storage the originals are discarded and the summary has no archive
+	c.MaxTokens = 10
+	ok, err = c.Compact(ctx, chat)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"system", "user", "assistant"}, roles(chat.Messages))
+	_, err = chat.LoadCompacted(ctx, chat.Messages[1])
+	assert.ErrorContains(t, err, "no compaction archive")
+
+	// Nothing left to compact
+	single := new(aichat.Chat)
+	single.AddUserContent("hello")
+	ok, err = c.Compact(ctx, single)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCompactorErrors(t *testing.T) {
+	ctx := context.Background()
+	chat := newToolChat()
+	c := &aichat.Compactor{Summarize: func(ctx context.Context, messages []*aichat.Message) (string, error) {
+		return "", errors.New("model unavailable")
+	}}
+	_, err := c.Compact(ctx, chat)
+	assert.ErrorContains(t, err, "s3 storage not initialized")
+	assert.Equal(t, 7, chat.MessageCount())
+
+	c.DiscardOriginals = true
+	_, err = c.Compact(ctx, chat)
+	assert.ErrorContains(t, err, "failed to summarize messages")
+	assert.Equal(t, 7, chat.MessageCount())
+
+	chat.Options.S3 = &mockS3WithErrors{mockS3: *newMockS3(), shouldErrorOnGet: true}
+	c.Summarize = summarizeRoles
+	ok, err := c.Compact(ctx, chat)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// A chat without key or ID is archived under a generated ID
+	tag, _ := chat.Messages[1].Meta().Get(aichat.MetaCompaction).(map[string]any)
+	assert.Regexp(t, `^chat_[0-9a-f]+/compacted/\d+$`, tag["archive"])
+	_, err = chat.LoadCompacted(ctx, chat.Messages[1])
+	assert.ErrorContains(t, err, "failed to get compacted messages")
+
+	chat.Options.S3 = nil
+	_, err = chat.LoadCompacted(ctx, chat.Messages[1])
+	assert.ErrorContains(t, err, "s3 storage not initialized")
+}
+
+func TestCompactorClient(t *testing.T) {
+	ctx := context.Background()
+	chat := newToolChat()
+
+	// A zero Compactor reports the missing summarizer
+	_, err := (&aichat.Compactor{DiscardOriginals: true}).Compact(ctx, chat)
+	assert.ErrorContains(t, err, "no Summarize function or Client")
+	assert.Equal(t, 7, chat.MessageCount())
+
+	var req *aichat.CompletionRequest
+	c := &aichat.Compactor{
+		Client: aichat.CompleterFunc(func(ctx context.Context, r *aichat.CompletionRequest) (*aichat.Message, error) {
+			req = r
+			return &aichat.Message{Role: "assistant", Content: " The user asked about the weather. "}, nil
+		}),
+		Model:            "summary-model",
+		KeepTokens:       20,
+		Role:             "assistant",
+		DiscardOriginals: true,
+	}
+	ok, err := c.Compact(ctx, chat)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"system", "assistant", "user", "assistant"}, roles(chat.Messages))
+	assert.Equal(t, "The user asked about the weather.", chat.Messages[1].Content)
+	require.NotNil(t, req)
+	assert.Equal(t, "summary-model", req.Model)
+	assert.Equal(t, []string{"user", "assistant", "tool", "assistant", "user"}, roles(req.Messages))
+	assert.Equal(t, aichat.DefaultSummaryPrompt, req.Messages[4].Content)
+
+	// Empty summaries are reported
+	c.Client = aichat.CompleterFunc(func(ctx context.Context, r *aichat.CompletionRequest) (*aichat.Message, error) {
+		return &aichat.Message{Role: "assistant", Content: ""}, nil
+	})
+	c.MaxTokens = 1
+	_, err = c.Compact(ctx, newToolChat())
+	assert.ErrorContains(t, err, "empty summary")
+}
@@ -0,0 +1,198 @@
+package aichat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider error classes, matched with errors.Is against a *ProviderError
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrQuotaExceeded         = errors.New("quota exceeded")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrContentFiltered       = errors.New("content filtered")
+	ErrAuth                  = errors.New("authentication failed")
+	ErrServer                = errors.New("server error")
+	ErrBadRequest            = errors.New("bad request")
+)
+
+// ProviderError is an error returned by an LLM provider
+type ProviderError struct {
+	// StatusCode is the HTTP status code, or the provider error code if it is one
+	StatusCode int
+	// Code is the provider-specific error code, if any
+	Code string
+	// Message is the provider error message
+	Message string
+	// RetryAfter is the delay requested by the provider before retrying
+	RetryAfter time.Duration
+	// Kind is the error class, one of the Err* variables or nil if unknown
+	Kind error
+}
+
+// NewProviderError classifies a provider error from its status code and message
+func NewProviderError(statusCode int, code, message string) *ProviderError {
+	return &ProviderError{
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    message,
+		Kind:       classifyError(statusCode, code+" "+message),
+	}
+}
+
+// Error implements the error interface
+func (e *ProviderError) Error() string {
+	var b strings.Builder
+	b.WriteString("provider error")
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " %d", e.StatusCode)
+	}
+	if e.Kind != nil {
+		fmt.Fprintf(&b, " (%s)", e.Kind)
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// Unwrap returns the error class so that errors.Is matches the Err* variables
+func (e *ProviderError) Unwrap() error {
+	return e.Kind
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *ProviderError) Temporary() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrServer
+}
+
+// classifyError maps a status code and error text to an error class.
+// The text is checked first since providers report context length and
+// content filtering errors with generic status codes.
+func classifyError(statusCode int, text string) error {
+	text = strings.ToLower(text)
+	switch {
+	case containsAny(text, "context length", "context_length", "context window", "maximum context", "too many tokens", "prompt is too long"):
+		return ErrContextLengthExceeded
+	case containsAny(text, "content filter", "content_filter", "moderation", "flagged", "safety"):
+		return ErrContentFiltered
+	case containsAny(text, "insufficient_quota", "insufficient quota", "exceeded your current quota", "insufficient credits", "billing"):
+		// Billing errors are permanent, although some providers report them with status 429
+		return ErrQuotaExceeded
+	case containsAny(text, "rate limit", "rate_limit", "too many requests", "quota"):
+		return ErrRateLimited
+	}
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusPaymentRequired:
+		return ErrQuotaExceeded
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return ErrContextLengthExceeded
+	case statusCode == http.StatusUnavailableForLegalReasons:
+		return ErrContentFiltered
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrAuth
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return ErrServer
+	case statusCode >= 400:
+		return ErrBadRequest
+	}
+	return nil
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxErrorBody limits how much of an error response body is read
+const maxErrorBody = 64 << 10
+
+// ErrorFromResponse returns a *ProviderError for a non-2xx HTTP response, or nil.
+// It reads the response body, parsing an OpenAI-style {"error": {...}} object when present,
+// and honors the Retry-After header.
+func ErrorFromResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	message := strings.TrimSpace(string(body))
+	code := ""
+	var payload struct {
+		Error *struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != nil {
+		message = payload.Error.Message
+		code = strings.Trim(string(payload.Error.Code), `"`)
+		if code == "" || code == "null" {
+			code = payload.Error.Type
+		}
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	err := NewProviderError(resp.StatusCode, code, message)
+	err.RetryAfter = ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return err
+}
+
+// ParseRetryAfter parses a Retry-After header value in seconds or as an HTTP date.
+// It returns 0 if the value is empty, invalid or in the past.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// IsRetryable reports whether an error is transient: a rate limit or server error,
+// or a network error. Context cancellation is never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.Temporary()
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryAfter returns the delay requested by the provider in err, or 0
+func RetryAfter(err error) time.Duration {
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package aichat_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestProviderErrorClassification(t *testing.T) {
+	tests := []struct {
+		status    int
+		message   string
+		kind      error
+		retryable bool
+	}{
+		{429, "slow down", aichat.ErrRateLimited, true},
+		{400, "This model's maximum context length is 8192 tokens", aichat.ErrContextLengthExceeded, false},
+		{413, "request too large", aichat.ErrContextLengthExceeded, false},
+		{403, "Input was flagged by moderation", aichat.ErrContentFiltered, false},
+		{401, "No auth credentials found", aichat.ErrAuth, false},
+		{502, "upstream error", aichat.ErrServer, true},
+		{529, "overloaded", aichat.ErrServer, true},
+		{408, "timeout", aichat.ErrServer, true},
+		{400, "invalid model", aichat.ErrBadRequest, false},
+		{0, "Rate limit exceeded", aichat.ErrRateLimited, true},
+		{429, "Quota exceeded for requests per minute", aichat.ErrRateLimited, true},
+		{429, "You exceeded your current quota, please check your plan and billing details", aichat.ErrQuotaExceeded, false},
+		{402, "Insufficient credits", aichat.ErrQuotaExceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d %s", tt.status, tt.message), func(t *testing.T) {
+			err := aichat.NewProviderError(tt.status, "", tt.message)
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Equal(t, tt.retryable, aichat.IsRetryable(fmt.Errorf("wrapped: %w", err)))
+		})
+	}
+
+	err := aichat.NewProviderError(200, "", "")
+	assert.Nil(t, err.Kind)
+	assert.Equal(t, "provider error 200", err.Error())
+	assert.Equal(t, "provider error 429 (rate limited): slow down", aichat.NewProviderError(429, "", "slow down").Error())
+}
+
+func TestErrorFromResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 400,
+		Header:     http.Header{"Retry-After": {"2"}},
+		Body:       io.NopCloser(strings.NewReader(`{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`)),
+	}
+	err := aichat.ErrorFromResponse(resp)
+	var perr *aichat.ProviderError
+	require.ErrorAs(t, err, &perr)
+	assert.ErrorIs(t, err, aichat.ErrContextLengthExceeded)
+	assert.Equal(t, "context_length_exceeded", perr.Code)
+	assert.Equal(t, "too long", perr.Message)
+	assert.Equal(t, 2*time.Second, perr.RetryAfter)
+
+	resp = &http.Response{StatusCode: 503, Body: io.NopCloser(strings.NewReader(""))}
+	err = aichat.ErrorFromResponse(resp)
+	assert.ErrorIs(t, err, aichat.ErrServer)
+	assert.Contains(t, err.Error(), "Service Unavailable")
+
+	resp = &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("{}"))}
+	assert.NoError(t, aichat.ErrorFromResponse(resp))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, aichat.ParseRetryAfter("3", now))
+	assert.Equal(t, 1500*time.Millisecond, aichat.ParseRetryAfter("1.5", now))
+	assert.Equal(t, 10*time.Second, aichat.ParseRetryAfter("Sun, 09 Feb 2025 12:00:10 GMT", now))
+	assert.Zero(t, aichat.ParseRetryAfter("Sun, 09 Feb 2025 11:00:00 GMT", now))
+	assert.Zero(t, aichat.ParseRetryAfter("", now))
+	assert.Zero(t, aichat.ParseRetryAfter("-1", now))
+	assert.Zero(t, aichat.ParseRetryAfter("soon", now))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, aichat.IsRetryable(nil))
+	assert.False(t, aichat.IsRetryable(context.Canceled))
+	assert.False(t, aichat.IsRetryable(errors.New("boom")))
+	assert.True(t, aichat.IsRetryable(io.ErrUnexpectedEOF))
+	_, err := http.Get("http://127.0.0.1:1")
+	assert.True(t, aichat.IsRetryable(err))
+}
@@ -99,6 +99,9 @@ func main() {
 	// Add assistant's response to chat
 	if len(deepseekResp.Choices) > 0 {
 		chat.AddMessage(deepseekResp.Choices[0].Message)
+		if reasoning := deepseekResp.Choices[0].Message.Reasoning; reasoning != "" {
+			fmt.Println("Reasoning:", reasoning)
+		}
 		fmt.Println("Assistant:", deepseekResp.Choices[0].Message.ContentString())
 	}
 }
@@ -2,6 +2,8 @@ package tools
 
 import (
 	_ "embed"
+	"maps"
+	"slices"
 
 	"github.com/presbrey/aichat"
 	"gopkg.in/yaml.v3"
@@ -16,14 +18,15 @@ func init() {
 	yaml.Unmarshal(yamlBytes, &Library)
 }
 
+// Get returns the tools of a library entry, sorted by name so that requests are deterministic
 func Get(key string) []*aichat.Tool {
 	m := Library[key]
 	if m == nil {
 		return nil
 	}
 	values := make([]*aichat.Tool, 0, len(m))
-	for _, v := range m {
-		values = append(values, v)
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		values = append(values, m[name])
 	}
 	return values
 }
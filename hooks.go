@@ -0,0 +1,139 @@
+package aichat
+
+// MessageMiddleware runs before a message is added to a chat. It returns the message
+// to add, which may be the given message, a modified copy or a replacement, or nil to veto it.
+type MessageMiddleware func(chat *Chat, msg *Message) *Message
+
+// MessageHook observes a message added to or removed from a chat
+type MessageHook func(chat *Chat, msg *Message)
+
+// SystemHook observes a change of the leading system message; old or new is nil
+// when the chat had no system message or no longer has one
+type SystemHook func(chat *Chat, old, new *Message)
+
+// chatHooks holds the middleware and observers registered on a chat
+type chatHooks struct {
+	middleware []MessageMiddleware
+	added      []MessageHook
+	removed    []MessageHook
+	system     []SystemHook
+}
+
+func (chat *Chat) ensureHooks() *chatHooks {
+	if chat.hooks == nil {
+		chat.hooks = &chatHooks{}
+	}
+	return chat.hooks
+}
+
+// Use registers middleware that can transform or veto messages before they are added
+// by AddMessage, UnshiftMessages, SetSystemMessage or ReplaceMessage. Middleware runs in
+// registration order, each receiving the output of the previous one.
+func (chat *Chat) Use(middleware ...MessageMiddleware) {
+	h := chat.ensureHooks()
+	h.middleware = append(h.middleware, middleware...)
+}
+
+// OnMessageAdded registers a hook called after a message is added to the chat, including
+// messages that become active by BranchAt or SwitchBranch and messages inserted by
+// Compactor.Compact or Repair
+func (chat *Chat) OnMessageAdded(fn MessageHook) {
+	h := chat.ensureHooks()
+	h.added = append(h.added, fn)
+}
+
+// OnMessageRemoved registers a hook called after a message is removed from the chat
+// by PopMessage, PopMessageIfRole, ShiftMessages, DeleteMessage, ReplaceMessage,
+// SetSystemMessage or ClearMessages, or leaves the active branch by BranchAt, SwitchBranch,
+// Compactor.Compact or Repair
+func (chat *Chat) OnMessageRemoved(fn MessageHook) {
+	h := chat.ensureHooks()
+	h.removed = append(h.removed, fn)
+}
+
+// OnSystemChanged registers a hook called after the leading system message changes
+func (chat *Chat) OnSystemChanged(fn SystemHook) {
+	h := chat.ensureHooks()
+	h.system = append(h.system, fn)
+}
+
+// admit runs the middleware on a message about to be added and returns the message to add, or nil
+func (chat *Chat) admit(msg *Message) *Message {
+	if chat.hooks == nil {
+		return msg
+	}
+	for _, mw := range chat.hooks.middleware {
+		if msg == nil {
+			return nil
+		}
+		msg = mw(chat, msg)
+	}
+	return msg
+}
+
+func (chat *Chat) notifyAdded(msg *Message) {
+	if chat.hooks == nil {
+		return
+	}
+	for _, fn := range chat.hooks.added {
+		fn(chat, msg)
+	}
+}
+
+func (chat *Chat) notifyRemoved(msgs ...*Message) {
+	if chat.hooks == nil {
+		return
+	}
+	for _, msg := range msgs {
+		for _, fn := range chat.hooks.removed {
+			fn(chat, msg)
+		}
+	}
+}
+
+// notifyChanged calls the observers for the messages removed from and added to the active
+// branch since it was previous, and for a change of the leading system message from system
+func (chat *Chat) notifyChanged(previous []*Message, system *Message) {
+	if chat.hooks == nil {
+		return
+	}
+	was := make(map[*Message]bool, len(previous))
+	for _, msg := range previous {
+		was[msg] = true
+	}
+	is := make(map[*Message]bool, len(chat.Messages))
+	for _, msg := range chat.Messages {
+		is[msg] = true
+	}
+	for _, msg := range previous {
+		if !is[msg] {
+			chat.notifyRemoved(msg)
+		}
+	}
+	for _, msg := range chat.Messages {
+		if !was[msg] {
+			chat.notifyAdded(msg)
+		}
+	}
+	chat.notifySystem(system)
+}
+
+// systemMessage returns the leading system message, or nil
+func (chat *Chat) systemMessage() *Message {
+	if len(chat.Messages) > 0 && chat.Messages[0].Role == "system" {
+		return chat.Messages[0]
+	}
+	return nil
+}
+
+// notifySystem calls the system hooks if the leading system message is no longer old
+func (chat *Chat) notifySystem(old *Message) {
+	if chat.hooks == nil {
+		return
+	}
+	if current := chat.systemMessage(); current != old {
+		for _, fn := range chat.hooks.system {
+			fn(chat, old, current)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package aichat_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestHooksObserveMutations(t *testing.T) {
+	chat := &aichat.Chat{}
+	var events []string
+	chat.OnMessageAdded(func(c *aichat.Chat, msg *aichat.Message) {
+		assert.Same(t, chat, c)
+		events = append(events, "added "+msg.Role+":"+msg.ContentString())
+	})
+	chat.OnMessageRemoved(func(c *aichat.Chat, msg *aichat.Message) {
+		events = append(events, "removed "+msg.Role+":"+msg.ContentString())
+	})
+
+	chat.AddUserContent("one")
+	chat.AddAssistantContent("two")
+	chat.UnshiftMessages(&aichat.Message{Role: "user", Content: "zero"})
+	chat.PopMessage()
+	chat.ShiftMessages()
+	chat.AddAssistantContent("three")
+	chat.PopMessageIfRole("user")
+	chat.PopMessageIfRole("assistant")
+	chat.AddAssistantContent("four")
+	chat.ClearMessages()
+
+	assert.Equal(t, []string{
+		"added user:one",
+		"added assistant:two",
+		"added user:zero",
+		"removed assistant:two",
+		"removed user:zero",
+		"added assistant:three",
+		"removed assistant:three",
+		"added assistant:four",
+		"removed user:one",
+		"removed assistant:four",
+	}, events)
+}
+
+func TestHooksReplaceAndDelete(t *testing.T) {
+	chat := &aichat.Chat{}
+	first := chat.AddUserContent("first")
+	second := chat.AddUserContent("second")
+
+	var added, removed []*aichat.Message
+	chat.OnMessageAdded(func(c *aichat.Chat, msg *aichat.Message) { added = append(added, msg) })
+	chat.OnMessageRemoved(func(c *aichat.Chat, msg *aichat.Message) { removed = append(removed, msg) })
+
+	replacement := &aichat.Message{Role: "user", Content: "first, edited"}
+	assert.Same(t, first, chat.ReplaceMessage(first.ID, replacement))
+	assert.Same(t, second, chat.DeleteMessage(second.ID))
+
+	assert.Equal(t, []*aichat.Message{replacement}, added)
+	assert.Equal(t, []*aichat.Message{first, second}, removed)
+}
+
+func TestOnSystemChanged(t *testing.T) {
+	chat := &aichat.Chat{}
+	type change struct{ old, new any }
+	var changes []change
+	content := func(msg *aichat.Message) any {
+		if msg == nil {
+			return nil
+		}
+		return msg.Content
+	}
+	chat.OnSystemChanged(func(c *aichat.Chat, old, new *aichat.Message) {
+		changes = append(changes, change{content(old), content(new)})
+	})
+
+	chat.AddUserContent("hello")
+	chat.SetSystemContent("be brief")
+	chat.SetSystemContent("be verbose")
+
+	// Setting the current system message again is not a change
+	var events int
+	chat.OnMessageAdded(func(*aichat.Chat, *aichat.Message) { events++ })
+	chat.OnMessageRemoved(func(*aichat.Chat, *aichat.Message) { events++ })
+	system := chat.Messages[0]
+	assert.Same(t, system, chat.SetSystemMessage(system))
+	assert.Equal(t, 0, events)
+	assert.Len(t, chat.Branches(), 1)
+
+	chat.AddAssistantContent("hi")
+	chat.ShiftMessages()
+	chat.AddRoleContent("system", "not leading")
+	chat.UnshiftMessages(&aichat.Message{Role: "system", Content: "leading"})
+	chat.ClearMessages()
+
+	assert.Equal(t, []change{
+		{nil, "be brief"},
+		{"be brief", "be verbose"},
+		{"be verbose", nil},
+		{nil, "leading"},
+		{"leading", nil},
+	}, changes)
+}
+
+func TestMiddlewareTransformAndVeto(t *testing.T) {
+	chat := &aichat.Chat{}
+	var added int
+	chat.OnMessageAdded(func(c *aichat.Chat, msg *aichat.Message) { added++ })
+
+	// Veto empty user messages
+	chat.Use(func(c *aichat.Chat, msg *aichat.Message) *aichat.Message {
+		if msg.Role == "user" && strings.TrimSpace(msg.ContentString()) == "" {
+			return nil
+		}
+		return msg
+	})
+	// Trim text content, returning a copy
+	chat.Use(func(c *aichat.Chat, msg *aichat.Message) *aichat.Message {
+		if s, ok := msg.Content.(string); ok {
+			trimmed := *msg
+			trimmed.Content = strings.TrimSpace(s)
+			return &trimmed
+		}
+		return msg
+	})
+
+	assert.Nil(t, chat.AddUserContent("   "))
+	chat.AddMessage(&aichat.Message{Role: "user", Content: ""})
+	assert.Equal(t, 0, chat.MessageCount())
+
+	msg := chat.AddUserContent("  hello  ")
+	require.NotNil(t, msg)
+	assert.Equal(t, "hello", msg.Content)
+	assert.NotEmpty(t, msg.ID)
+	assert.Same(t, msg, chat.LastMessage())
+
+	system := chat.SetSystemContent(" be brief ")
+	require.NotNil(t, system)
+	assert.Equal(t, "be brief", chat.Messages[0].Content)
+
+	first := chat.Messages[1]
+	assert.Nil(t, chat.ReplaceMessage(first.ID, &aichat.Message{Role: "user", Content: " "}))
+	assert.Same(t, first, chat.Messages[1], "vetoed replacement keeps the original")
+
+	assert.Equal(t, 2, added)
+}
+
+func TestHooksDoNotCarryToFork(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.AddUserContent("hello")
+	var events []string
+	chat.OnMessageAdded(func(c *aichat.Chat, msg *aichat.Message) {
+		events = append(events, msg.ContentString())
+	})
+
+	fork := chat.Fork(1)
+	fork.OnMessageAdded(func(c *aichat.Chat, msg *aichat.Message) {
+		events = append(events, "fork only")
+	})
+	fork.AddAssistantContent("from fork")
+	chat.AddAssistantContent("from original")
+
+	assert.Equal(t, []string{"fork only", "from original"}, events)
+}
+
+func TestHooksObserveBranchesAndRewrites(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.SetSystemContent("system")
+	chat.AddUserContent("question")
+	first := chat.AddAssistantContent("first answer")
+
+	var events []string
+	chat.OnMessageAdded(func(c *aichat.Chat, msg *aichat.Message) {
+		events = append(events, "added "+msg.ContentString())
+	})
+	chat.OnMessageRemoved(func(c *aichat.Chat, msg *aichat.Message) {
+		events = append(events, "removed "+msg.ContentString())
+	})
+	chat.OnSystemChanged(func(c *aichat.Chat, old, new *aichat.Message) {
+		events = append(events, fmt.Sprintf("system %v -> %v", old != nil, new != nil))
+	})
+
+	chat.BranchAt(2)
+	chat.AddAssistantContent("second answer")
+	require.NoError(t, chat.SwitchBranch(first.ID))
+	chat.BranchAt(0)
+	assert.Equal(t, []string{
+		"removed first answer",
+		"added second answer",
+		"removed second answer",
+		"added first answer",
+		"removed system",
+		"removed question",
+		"removed first answer",
+		"system true -> false",
+	}, events)
+
+	events = nil
+	chat.AddUserContent("hello")
+	chat.AddUserContent("anyone there?")
+	assert.Empty(t, chat.Repair(aichat.DefaultRepairPolicy))
+	assert.Equal(t, []string{
+		"added hello",
+		"added anyone there?",
+		"removed hello",
+		"removed anyone there?",
+		"added hello\n\nanyone there?",
+	}, events)
+
+	events = nil
+	chat.AddAssistantContent("hi")
+	c := &aichat.Compactor{Summarize: summarizeRoles, DiscardOriginals: true}
+	ok, err := c.Compact(context.Background(), chat)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{
+		"added hi",
+		"removed hello\n\nanyone there?",
+		"added 1 messages: [user]",
+	}, events)
+}
@@ -0,0 +1,92 @@
+package aichat
+
+import (
+	"iter"
+	"slices"
+)
+
+// All returns an iterator over the messages and their indexes, oldest first.
+// Messages added while iterating are not visited.
+func (chat *Chat) All() iter.Seq2[int, *Message] {
+	return slices.All(chat.Messages)
+}
+
+// Backward returns an iterator over the messages and their indexes, newest first
+func (chat *Chat) Backward() iter.Seq2[int, *Message] {
+	return slices.Backward(chat.Messages)
+}
+
+// ByRole returns an iterator over the messages with the given role and their indexes
+func (chat *Chat) ByRole(role string) iter.Seq2[int, *Message] {
+	return Filter(chat.All(), RoleIs(role))
+}
+
+// MessageFilter reports whether a message should be kept by Filter
+type MessageFilter func(msg *Message) bool
+
+// Filter returns an iterator over the messages of seq accepted by every filter
+func Filter(seq iter.Seq2[int, *Message], filters ...MessageFilter) iter.Seq2[int, *Message] {
+	return func(yield func(int, *Message) bool) {
+		for i, msg := range seq {
+			if matchAll(msg, filters) && !yield(i, msg) {
+				return
+			}
+		}
+	}
+}
+
+func matchAll(msg *Message, filters []MessageFilter) bool {
+	for _, f := range filters {
+		if !f(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// RoleIs accepts messages with one of the roles
+func RoleIs(roles ...string) MessageFilter {
+	return func(msg *Message) bool {
+		return slices.Contains(roles, msg.Role)
+	}
+}
+
+// HasContentType accepts messages with content of the given type: PartTypeText for
+// string content, a part type for multipart content with such a part, or the "type"
+// of map content as in LastMessageByType
+func HasContentType(contentType string) MessageFilter {
+	return func(msg *Message) bool {
+		switch content := msg.Content.(type) {
+		case string:
+			return contentType == PartTypeText
+		case map[string]any:
+			t, _ := content["type"].(string)
+			return t == contentType
+		}
+		parts, _ := msg.ContentParts()
+		return slices.ContainsFunc(parts, func(p *Part) bool {
+			return p.Type == contentType
+		})
+	}
+}
+
+// HasMeta accepts messages with a non-nil value for the meta key
+func HasMeta(key string) MessageFilter {
+	return func(msg *Message) bool {
+		return msg.Meta().Get(key) != nil
+	}
+}
+
+// HasToolCalls accepts messages calling tools
+func HasToolCalls() MessageFilter {
+	return func(msg *Message) bool {
+		return len(msg.ToolCalls) > 0
+	}
+}
+
+// Not accepts messages rejected by filter
+func Not(filter MessageFilter) MessageFilter {
+	return func(msg *Message) bool {
+		return !filter(msg)
+	}
+}
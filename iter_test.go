@@ -0,0 +1,118 @@
+package aichat_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func newIterChat() *aichat.Chat {
+	chat := &aichat.Chat{}
+	chat.SetSystemContent("be brief")
+	chat.AddUserContent("weather?")
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1"), weatherCall("call_2")})
+	chat.AddToolRawContent("get_weather", "call_1", "sunny")
+	chat.AddUserContent([]*aichat.Part{aichat.TextPart("and this?"), aichat.ImagePart("https://example.com/a.png")})
+	chat.AddAssistantContent("It is sunny.").Meta().Set("rating", 5)
+	return chat
+}
+
+// seqContents collects the text content of the messages of seq
+func seqContents(seq func(yield func(int, *aichat.Message) bool)) []any {
+	var out []any
+	for _, msg := range seq {
+		out = append(out, msg.Content)
+	}
+	return out
+}
+
+func TestAllAndBackward(t *testing.T) {
+	chat := newIterChat()
+	var indexes []int
+	for i, msg := range chat.All() {
+		assert.Same(t, chat.Messages[i], msg)
+		indexes = append(indexes, i)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, indexes)
+
+	indexes = nil
+	for i := range chat.Backward() {
+		indexes = append(indexes, i)
+		if i == 4 {
+			break
+		}
+	}
+	assert.Equal(t, []int{5, 4}, indexes)
+
+	// Messages added while iterating are not visited
+	n := 0
+	for range chat.All() {
+		if n == 0 {
+			chat.AddUserContent("more")
+		}
+		n++
+	}
+	assert.Equal(t, 6, n)
+}
+
+func TestByRole(t *testing.T) {
+	chat := newIterChat()
+	var indexes []int
+	for i, msg := range chat.ByRole("assistant") {
+		assert.Equal(t, "assistant", msg.Role)
+		indexes = append(indexes, i)
+	}
+	assert.Equal(t, []int{2, 5}, indexes)
+	assert.Empty(t, seqContents(chat.ByRole("developer")))
+}
+
+func TestFilter(t *testing.T) {
+	chat := newIterChat()
+	// Multipart content with a text part has the text content type
+	text := seqContents(aichat.Filter(chat.All(), aichat.HasContentType(aichat.PartTypeText), aichat.Not(aichat.RoleIs("tool"))))
+	require.Len(t, text, 4)
+	assert.Equal(t, []any{"be brief", "weather?"}, text[:2])
+	assert.Equal(t, "It is sunny.", text[3])
+
+	images := seqContents(aichat.Filter(chat.All(), aichat.HasContentType(aichat.PartTypeImageURL)))
+	assert.Equal(t, text[2:3], images)
+	assert.Equal(t, []any{"It is sunny."}, seqContents(aichat.Filter(chat.Backward(), aichat.HasMeta("rating"))))
+	assert.Equal(t, []any{"sunny", "weather?"}, seqContents(aichat.Filter(chat.Backward(), aichat.RoleIs("user", "tool"), aichat.Not(aichat.HasContentType(aichat.PartTypeImageURL)))))
+
+	var calls []int
+	for i := range aichat.Filter(chat.All(), aichat.HasToolCalls()) {
+		calls = append(calls, i)
+	}
+	assert.Equal(t, []int{2}, calls)
+
+	chat.AddRoleContent("assistant", map[string]any{"type": "weather", "temp": 20})
+	assert.Len(t, seqContents(aichat.Filter(chat.All(), aichat.HasContentType("weather"))), 1)
+}
+
+func TestPendingToolCalls(t *testing.T) {
+	chat := newIterChat()
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_3")})
+
+	var ids []string
+	for tc := range chat.PendingToolCalls() {
+		ids = append(ids, tc.ToolCall.ID)
+		require.NoError(t, tc.Return(map[string]any{"condition": "cloudy"}))
+	}
+	assert.Equal(t, []string{"call_2", "call_3"}, ids)
+	assert.Empty(t, slices.Collect(chat.PendingToolCalls()))
+
+	// Breaking early leaves the remaining calls pending
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_4"), weatherCall("call_5")})
+	for tc := range chat.PendingToolCalls() {
+		require.NoError(t, tc.Return(map[string]any{}))
+		break
+	}
+	pending := slices.Collect(chat.PendingToolCalls())
+	require.Len(t, pending, 1)
+	assert.Equal(t, "call_5", pending[0].ToolCall.ID)
+	assert.Equal(t, "get_weather", pending[0].Name())
+}
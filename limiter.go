@@ -0,0 +1,260 @@
+package aichat
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock tells time for rate limiting, so that tests can substitute a fake clock
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// rateWindow is the period of RPM and TPM budgets
+const rateWindow = time.Minute
+
+// Limiter is a Completer that enforces requests-per-minute and tokens-per-minute budgets
+// on a wrapped client. Requests are admitted in round-robin order across tenants so that
+// one busy tenant cannot starve the others.
+//
+// Tokens are estimated with the token counter before a request is sent and corrected
+// with the usage recorded on the reply (see MetaUsage).
+type Limiter struct {
+	// Client sends the admitted requests
+	Client Completer
+	// RPM is the requests-per-minute budget (0 is unlimited)
+	RPM int
+	// TPM is the tokens-per-minute budget (0 is unlimited).
+	// A request larger than the budget is admitted alone once the window is empty.
+	TPM int
+	// TokenCounter estimates request tokens (default ApproxCounter)
+	TokenCounter TokenCounter
+	// TenantKey is the request meta key identifying the tenant (default "tenant")
+	TenantKey string
+	// Clock tells time (default the system clock)
+	Clock Clock
+
+	mu      sync.Mutex
+	sent    []*rateRecord
+	queues  map[string][]*rateWaiter
+	tenants []string // tenants with queued requests, in round-robin order
+	timer   bool
+}
+
+// rateRecord is a request admitted within the window
+type rateRecord struct {
+	at     time.Time
+	tokens int
+}
+
+// rateWaiter is a queued request
+type rateWaiter struct {
+	tokens int
+	ready  chan *rateRecord
+}
+
+// Complete implements Completer, waiting until the request fits the budgets
+func (l *Limiter) Complete(ctx context.Context, req *CompletionRequest) (*Message, error) {
+	counter := l.TokenCounter
+	if counter == nil {
+		counter = ApproxCounter{}
+	}
+	estimate := CountRequestTokens(counter, req)
+
+	record, err := l.wait(ctx, l.tenant(req), estimate)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		// Nothing is sent, so the request does not count toward the budgets
+		l.mu.Lock()
+		l.release(record)
+		l.mu.Unlock()
+		return nil, err
+	}
+	msg, err := l.Client.Complete(ctx, req)
+	if err == nil && msg != nil {
+		if u := msg.Usage(); u != nil && u.TotalTokens > 0 {
+			l.mu.Lock()
+			record.tokens = u.TotalTokens
+			l.dispatch()
+			l.mu.Unlock()
+		}
+	}
+	return msg, err
+}
+
+// Queued returns the number of requests waiting for budget
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, q := range l.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (l *Limiter) tenant(req *CompletionRequest) string {
+	key := l.TenantKey
+	if key == "" {
+		key = "tenant"
+	}
+	if req.Meta == nil || req.Meta[key] == nil {
+		return ""
+	}
+	return fmt.Sprint(req.Meta[key])
+}
+
+func (l *Limiter) clock() Clock {
+	if l.Clock != nil {
+		return l.Clock
+	}
+	return realClock{}
+}
+
+// wait queues the request and blocks until it is admitted or ctx is done
+func (l *Limiter) wait(ctx context.Context, tenant string, tokens int) (*rateRecord, error) {
+	w := &rateWaiter{tokens: tokens, ready: make(chan *rateRecord, 1)}
+	l.mu.Lock()
+	if l.queues == nil {
+		l.queues = make(map[string][]*rateWaiter)
+	}
+	if len(l.queues[tenant]) == 0 {
+		l.tenants = append(l.tenants, tenant)
+	}
+	l.queues[tenant] = append(l.queues[tenant], w)
+	l.dispatch()
+	l.mu.Unlock()
+
+	select {
+	case record := <-w.ready:
+		return record, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case record := <-w.ready:
+			// Admitted concurrently with cancellation; give the budget back
+			l.release(record)
+		default:
+			l.dequeue(tenant, w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release removes an admitted request that was not sent from the window.
+// It must be called with l.mu held.
+func (l *Limiter) release(record *rateRecord) {
+	for i, r := range l.sent {
+		if r == record {
+			l.sent = append(l.sent[:i:i], l.sent[i+1:]...)
+			break
+		}
+	}
+	l.dispatch()
+}
+
+// dequeue removes a canceled waiter
+func (l *Limiter) dequeue(tenant string, w *rateWaiter) {
+	q := l.queues[tenant]
+	for i, qw := range q {
+		if qw == w {
+			l.queues[tenant] = append(q[:i:i], q[i+1:]...)
+			break
+		}
+	}
+	if len(l.queues[tenant]) == 0 {
+		delete(l.queues, tenant)
+		l.removeTenant(tenant)
+	}
+	l.dispatch()
+}
+
+func (l *Limiter) removeTenant(tenant string) {
+	for i, t := range l.tenants {
+		if t == tenant {
+			l.tenants = append(l.tenants[:i:i], l.tenants[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch admits queued requests in round-robin order while they fit the budgets,
+// and schedules a retry for when the oldest request leaves the window. A tenant whose
+// next request does not fit is passed over, so that it does not hold back smaller
+// requests of other tenants, and keeps its turn. It must be called with l.mu held.
+func (l *Limiter) dispatch() {
+	now := l.clock().Now()
+	cutoff := now.Add(-rateWindow)
+	for len(l.sent) > 0 && !l.sent[0].at.After(cutoff) {
+		l.sent = l.sent[1:]
+	}
+
+	for {
+		// The first tenant in round-robin order whose next request fits
+		i := slices.IndexFunc(l.tenants, func(tenant string) bool {
+			return l.fits(l.queues[tenant][0].tokens)
+		})
+		if i < 0 {
+			break
+		}
+		tenant := l.tenants[i]
+		w := l.queues[tenant][0]
+		record := &rateRecord{at: now, tokens: w.tokens}
+		l.sent = append(l.sent, record)
+		w.ready <- record
+
+		// Move the tenant to the back of the round-robin order
+		l.tenants = slices.Delete(l.tenants, i, i+1)
+		if q := l.queues[tenant][1:]; len(q) > 0 {
+			l.queues[tenant] = q
+			l.tenants = append(l.tenants, tenant)
+		} else {
+			delete(l.queues, tenant)
+		}
+	}
+
+	if len(l.tenants) > 0 && len(l.sent) > 0 && !l.timer {
+		l.timer = true
+		expire := l.clock().After(l.sent[0].at.Add(rateWindow).Sub(now))
+		go func() {
+			<-expire
+			l.mu.Lock()
+			l.timer = false
+			l.dispatch()
+			l.mu.Unlock()
+		}()
+	}
+}
+
+// fits reports whether a request of the given tokens fits the current window
+func (l *Limiter) fits(tokens int) bool {
+	if len(l.sent) == 0 {
+		return true
+	}
+	if l.RPM > 0 && len(l.sent) >= l.RPM {
+		return false
+	}
+	if l.TPM > 0 {
+		used := 0
+		for _, r := range l.sent {
+			used += r.tokens
+		}
+		if used+tokens > l.TPM {
+			return false
+		}
+	}
+	return true
+}
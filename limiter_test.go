@@ -0,0 +1,192 @@
+package aichat_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+	"github.com/presbrey/aichat/aichattest"
+)
+
+// recordingCompleter replies with the request's last message and records the order of calls
+type recordingCompleter struct {
+	mu     sync.Mutex
+	served []string
+	usage  int
+}
+
+func (r *recordingCompleter) Complete(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	content := req.Messages[len(req.Messages)-1].ContentString()
+	r.served = append(r.served, content)
+	msg := &aichat.Message{Role: "assistant", Content: content}
+	if r.usage > 0 {
+		msg.SetUsage(aichat.Usage{TotalTokens: r.usage})
+	}
+	return msg, nil
+}
+
+func (r *recordingCompleter) Served() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.served...)
+}
+
+func limiterRequest(tenant, content string) *aichat.CompletionRequest {
+	chat := &aichat.Chat{Meta: map[string]any{"tenant": tenant}}
+	chat.AddUserContent(content)
+	return chat.CompletionRequest("model")
+}
+
+// startRequest sends a request in the background once the previous ones are queued
+func startRequest(t *testing.T, limiter *aichat.Limiter, req *aichat.CompletionRequest, queued int, wg *sync.WaitGroup) {
+	t.Helper()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := limiter.Complete(context.Background(), req)
+		assert.NoError(t, err)
+	}()
+	require.Eventually(t, func() bool { return limiter.Queued() == queued }, time.Second, time.Millisecond)
+}
+
+func TestLimiterRPM(t *testing.T) {
+	clock := aichattest.NewFakeClock(time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC))
+	client := &recordingCompleter{}
+	limiter := &aichat.Limiter{Client: client, RPM: 2, Clock: clock}
+	ctx := context.Background()
+
+	for _, content := range []string{"one", "two"} {
+		_, err := limiter.Complete(ctx, limiterRequest("", content))
+		require.NoError(t, err)
+	}
+	var wg sync.WaitGroup
+	startRequest(t, limiter, limiterRequest("", "three"), 1, &wg)
+	assert.Equal(t, []string{"one", "two"}, client.Served())
+
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, 1, limiter.Queued())
+	clock.Advance(time.Second)
+	wg.Wait()
+	assert.Equal(t, []string{"one", "two", "three"}, client.Served())
+}
+
+func TestLimiterTPM(t *testing.T) {
+	clock := aichattest.NewFakeClock(time.Now())
+	client := &recordingCompleter{usage: 90}
+	limiter := &aichat.Limiter{Client: client, TPM: 100, Clock: clock}
+	ctx := context.Background()
+
+	// The estimate fits, but the actual usage reported by the reply uses most of the budget
+	_, err := limiter.Complete(ctx, limiterRequest("", "short"))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	startRequest(t, limiter, limiterRequest("", strings.Repeat("long ", 20)), 1, &wg)
+	clock.Advance(time.Minute)
+	wg.Wait()
+	assert.Len(t, client.Served(), 2)
+
+	// Requests larger than the budget are admitted alone
+	_, err = (&aichat.Limiter{Client: client, TPM: 1, Clock: clock}).Complete(ctx, limiterRequest("", "too big"))
+	assert.NoError(t, err)
+}
+
+func TestLimiterFairQueueing(t *testing.T) {
+	clock := aichattest.NewFakeClock(time.Now())
+	client := &recordingCompleter{}
+	limiter := &aichat.Limiter{Client: client, RPM: 1, Clock: clock}
+
+	_, err := limiter.Complete(context.Background(), limiterRequest("a", "a1"))
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	startRequest(t, limiter, limiterRequest("a", "a2"), 1, &wg)
+	startRequest(t, limiter, limiterRequest("a", "a3"), 2, &wg)
+	startRequest(t, limiter, limiterRequest("b", "b1"), 3, &wg)
+
+	for queued := 2; queued >= 0; queued-- {
+		clock.Advance(time.Minute)
+		require.Eventually(t, func() bool { return limiter.Queued() == queued }, time.Second, time.Millisecond)
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"a1", "a2", "b1", "a3"}, client.Served())
+}
+
+func TestLimiterCancel(t *testing.T) {
+	clock := aichattest.NewFakeClock(time.Now())
+	client := &recordingCompleter{}
+	limiter := &aichat.Limiter{Client: client, RPM: 1, Clock: clock, TenantKey: "customer"}
+
+	_, err := limiter.Complete(context.Background(), limiterRequest("", "first"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := limiter.Complete(ctx, limiterRequest("", "canceled"))
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return limiter.Queued() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Zero(t, limiter.Queued())
+
+	clock.Advance(time.Minute)
+	_, err = limiter.Complete(context.Background(), limiterRequest("", "second"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, client.Served())
+}
+
+func TestLimiterNoHeadOfLineBlocking(t *testing.T) {
+	clock := aichattest.NewFakeClock(time.Now())
+	client := &recordingCompleter{usage: 60}
+	limiter := &aichat.Limiter{Client: client, TPM: 100, Clock: clock}
+
+	_, err := limiter.Complete(context.Background(), limiterRequest("a", "a1"))
+	require.NoError(t, err)
+
+	// A large request of tenant a waits for the window to clear...
+	var wg sync.WaitGroup
+	startRequest(t, limiter, limiterRequest("a", strings.Repeat("large ", 40)), 1, &wg)
+
+	// ...without holding back a small request of tenant b
+	_, err = limiter.Complete(context.Background(), limiterRequest("b", "b1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "b1"}, client.Served())
+	assert.Equal(t, 1, limiter.Queued())
+
+	clock.Advance(time.Minute)
+	wg.Wait()
+	assert.Len(t, client.Served(), 3)
+}
+
+func TestLimiterCanceledAfterAdmission(t *testing.T) {
+	clock := aichattest.NewFakeClock(time.Now())
+	client := &recordingCompleter{}
+	limiter := &aichat.Limiter{Client: client, RPM: 1, Clock: clock}
+
+	// A request canceled before it is sent does not use the budget
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := limiter.Complete(ctx, limiterRequest("", "canceled"))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = limiter.Complete(context.Background(), limiterRequest("", "sent"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sent"}, client.Served())
+
+	// Replies without a message are passed through
+	empty := &aichat.Limiter{Client: aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return nil, nil
+	})}
+	msg, err := empty.Complete(context.Background(), limiterRequest("", "empty"))
+	assert.NoError(t, err)
+	assert.Nil(t, msg)
+}
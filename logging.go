@@ -0,0 +1,191 @@
+package aichat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Logging writes structured logs of model requests and responses, tool dispatch and
+// storage timings with log/slog. Wrap a client with Completer to log model requests,
+// and set Options.Logging to log tool calls run by RangePendingToolCalls and Load/Save.
+//
+// Message content and tool arguments are logged as a hash and length unless LogContent
+// is set, so that verbose logs can be enabled without leaking user data. Values found by
+// the detectors are masked in every other logged string, such as error messages.
+type Logging struct {
+	// Logger receives the logs (default slog.Default())
+	Logger *slog.Logger
+	// Level of request, tool and storage logs (default slog.LevelDebug).
+	// Failures are logged at slog.LevelWarn or above.
+	Level slog.Leveler
+	// Detectors find the values masked in logged strings (default DefaultDetectors)
+	Detectors []Detector
+	// LogContent logs message content and tool arguments, masked, instead of hashes
+	LogContent bool
+}
+
+func (l *Logging) logger() *slog.Logger {
+	if l.Logger != nil {
+		return l.Logger
+	}
+	return slog.Default()
+}
+
+func (l *Logging) level() slog.Level {
+	if l.Level != nil {
+		return l.Level.Level()
+	}
+	return slog.LevelDebug
+}
+
+func (l *Logging) enabled(ctx context.Context) bool {
+	return l.logger().Enabled(ctx, l.level())
+}
+
+// log logs at the configured level, or at slog.LevelWarn if err is set
+func (l *Logging) log(ctx context.Context, err error, msg string, attrs ...slog.Attr) {
+	level := l.level()
+	if err != nil {
+		level = max(level, slog.LevelWarn)
+		attrs = append(attrs, slog.String("error", l.redact(err.Error())))
+	}
+	l.logger().LogAttrs(ctx, level, msg, attrs...)
+}
+
+// redact masks the values found by the detectors in s
+func (l *Logging) redact(s string) string {
+	detectors := l.Detectors
+	if detectors == nil {
+		detectors = DefaultDetectors
+	}
+	for _, d := range detectors {
+		s = d.Mask(s)
+	}
+	return s
+}
+
+// content returns the log value of message content or tool arguments
+func (l *Logging) content(v any) slog.Value {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return slog.StringValue("")
+	case string:
+		s = v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return slog.StringValue("<unencodable>")
+		}
+		s = string(b)
+	}
+	if l.LogContent {
+		return slog.StringValue(l.redact(s))
+	}
+	return slog.StringValue(ContentHash(s))
+}
+
+// ContentHash returns the digest and length logged in place of content, e.g. "sha256:1a2b3c4d5e6f len=42"
+func ContentHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:6]) + " len=" + strconv.Itoa(len(s))
+}
+
+// messages returns the log value of a request or response payload
+func (l *Logging) messages(msgs []*Message) slog.Value {
+	attrs := make([]slog.Attr, 0, len(msgs))
+	for i, msg := range msgs {
+		attrs = append(attrs, slog.Attr{Key: strconv.Itoa(i), Value: l.message(msg)})
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (l *Logging) message(msg *Message) slog.Value {
+	attrs := []slog.Attr{slog.String("role", msg.Role)}
+	if msg.ID != "" {
+		attrs = append(attrs, slog.String("id", msg.ID))
+	}
+	if msg.Name != "" {
+		attrs = append(attrs, slog.String("name", msg.Name))
+	}
+	if msg.ToolCallID != "" {
+		attrs = append(attrs, slog.String("tool_call_id", msg.ToolCallID))
+	}
+	if msg.Content != nil {
+		attrs = append(attrs, slog.Any("content", l.content(msg.Content)))
+	}
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]slog.Attr, 0, len(msg.ToolCalls))
+		for i, call := range msg.ToolCalls {
+			calls = append(calls, slog.Group(strconv.Itoa(i),
+				slog.String("id", call.ID),
+				slog.String("name", call.Function.Name),
+				slog.Any("arguments", l.content(call.Function.Arguments)),
+			))
+		}
+		attrs = append(attrs, slog.Attr{Key: "tool_calls", Value: slog.GroupValue(calls...)})
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Completer returns a Completer that logs the requests sent to client and their responses
+func (l *Logging) Completer(client Completer) Completer {
+	return CompleterFunc(func(ctx context.Context, req *CompletionRequest) (*Message, error) {
+		enabled := l.enabled(ctx)
+		if enabled {
+			l.log(ctx, nil, "aichat request",
+				slog.String("model", req.Model),
+				slog.Int("tools", len(req.Tools)),
+				slog.Any("messages", l.messages(req.Messages)),
+			)
+		}
+		start := time.Now()
+		msg, err := client.Complete(ctx, req)
+		if !enabled && err == nil {
+			return msg, nil
+		}
+		attrs := []slog.Attr{
+			slog.String("model", req.Model),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if msg != nil {
+			attrs = append(attrs, slog.Any("message", l.message(msg)))
+			if u := msg.Usage(); u != nil {
+				attrs = append(attrs, slog.Int("prompt_tokens", u.PromptTokens), slog.Int("completion_tokens", u.CompletionTokens))
+			}
+		}
+		l.log(ctx, err, "aichat response", attrs...)
+		return msg, err
+	})
+}
+
+// logTool runs a tool call and logs its dispatch
+func (l *Logging) logTool(ctx context.Context, tcc *ToolCallContext, fn func(*ToolCallContext) error) error {
+	start := time.Now()
+	err := fn(tcc)
+	if err == nil && !l.enabled(ctx) {
+		return nil
+	}
+	l.log(ctx, err, "aichat tool call",
+		slog.String("tool", tcc.Name()),
+		slog.String("tool_call_id", tcc.ToolCall.ID),
+		slog.Any("arguments", l.content(tcc.ToolCall.Function.Arguments)),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return err
+}
+
+// logStorage logs a Load or Save
+func (l *Logging) logStorage(ctx context.Context, op, key string, chat *Chat, start time.Time, err error) {
+	l.log(ctx, err, "aichat "+op,
+		slog.String("key", l.redact(key)),
+		slog.String("chat_id", chat.ID),
+		slog.Int("messages", len(chat.Messages)),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
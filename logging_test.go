@@ -0,0 +1,170 @@
+package aichat_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+// newTestLogging returns a Logging writing JSON records to the returned buffer
+func newTestLogging() (*aichat.Logging, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	return &aichat.Logging{Logger: logger}, &buf
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggingCompleter(t *testing.T) {
+	logging, buf := newTestLogging()
+	client := logging.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		msg := &aichat.Message{Role: "assistant", Content: "Sure, I emailed bob@example.com"}
+		msg.SetUsage(aichat.Usage{PromptTokens: 10, CompletionTokens: 5})
+		return msg, nil
+	}))
+
+	chat := &aichat.Chat{}
+	chat.AddUserContent("My email is alice@example.com")
+	_, err := client.Complete(context.Background(), chat.CompletionRequest("test/model"))
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.NotContains(t, out, "alice@example.com")
+	assert.NotContains(t, out, "bob@example.com")
+
+	records := logRecords(t, buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "aichat request", records[0]["msg"])
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "test/model", records[0]["model"])
+	first := records[0]["messages"].(map[string]any)["0"].(map[string]any)
+	assert.Equal(t, "user", first["role"])
+	assert.Equal(t, aichat.ContentHash("My email is alice@example.com"), first["content"])
+
+	assert.Equal(t, "aichat response", records[1]["msg"])
+	assert.Equal(t, float64(10), records[1]["prompt_tokens"])
+	assert.Contains(t, records[1], "duration")
+}
+
+func TestLoggingContentMasked(t *testing.T) {
+	logging, buf := newTestLogging()
+	logging.LogContent = true
+	client := logging.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return nil, errors.New("invalid key sk-or-v1-0123456789abcdef0123")
+	}))
+
+	chat := &aichat.Chat{}
+	chat.AddUserContent("Write to alice@example.com")
+	_, err := client.Complete(context.Background(), chat.CompletionRequest("test/model"))
+	require.Error(t, err)
+
+	out := buf.String()
+	assert.NotContains(t, out, "alice@example.com")
+	assert.NotContains(t, out, "0123456789abcdef")
+
+	records := logRecords(t, buf)
+	require.Len(t, records, 2)
+	first := records[0]["messages"].(map[string]any)["0"].(map[string]any)
+	assert.Equal(t, "Write to [REDACTED_EMAIL]", first["content"])
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, "invalid key [REDACTED_API_KEY]", records[1]["error"])
+}
+
+func TestLoggingCustomDetectors(t *testing.T) {
+	logging, buf := newTestLogging()
+	logging.LogContent = true
+	logging.Detectors = []aichat.Detector{{Kind: "SSN", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)}}
+	client := logging.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return &aichat.Message{Role: "assistant", Content: "ok"}, nil
+	}))
+
+	_, err := client.Complete(context.Background(), &aichat.CompletionRequest{
+		Messages: []*aichat.Message{{Role: "user", Content: "SSN 123-45-6789, alice@example.com"}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "SSN [REDACTED_SSN], alice@example.com")
+}
+
+func TestLoggingDisabledLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logging := &aichat.Logging{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	client := logging.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return &aichat.Message{Role: "assistant", Content: "ok"}, nil
+	}))
+	_, err := client.Complete(context.Background(), &aichat.CompletionRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	// Failures are logged at warn level
+	client = logging.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return nil, errors.New("boom")
+	}))
+	_, err = client.Complete(context.Background(), &aichat.CompletionRequest{})
+	require.Error(t, err)
+	records := logRecords(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "aichat response", records[0]["msg"])
+	assert.Equal(t, "WARN", records[0]["level"])
+}
+
+func TestLoggingToolCallsAndStorage(t *testing.T) {
+	logging, buf := newTestLogging()
+	chat := &aichat.Chat{ID: "chat-1", Options: aichat.Options{S3: newMockS3(), Logging: logging}}
+	chat.AddAssistantToolCall([]aichat.ToolCall{{
+		ID: "call_1", Type: "function",
+		Function: aichat.Function{Name: "send_email", Arguments: `{"to":"alice@example.com"}`},
+	}})
+
+	err := chat.RangePendingToolCalls(func(tc *aichat.ToolCallContext) error {
+		return tc.Return(map[string]any{"sent": true})
+	})
+	require.NoError(t, err)
+	require.NoError(t, chat.Save(context.Background(), "chats/chat-1"))
+	loaded := &aichat.Chat{Options: chat.Options}
+	require.NoError(t, loaded.Load(context.Background(), "chats/chat-1"))
+	assert.Error(t, loaded.Load(context.Background(), "missing"))
+
+	assert.NotContains(t, buf.String(), "alice@example.com")
+	records := logRecords(t, buf)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "aichat tool call", records[0]["msg"])
+	assert.Equal(t, "send_email", records[0]["tool"])
+	assert.Equal(t, "call_1", records[0]["tool_call_id"])
+	assert.Equal(t, aichat.ContentHash(`{"to":"alice@example.com"}`), records[0]["arguments"])
+
+	assert.Equal(t, "aichat save", records[1]["msg"])
+	assert.Equal(t, "chats/chat-1", records[1]["key"])
+	assert.Equal(t, float64(2), records[1]["messages"])
+	assert.Contains(t, records[1], "duration")
+
+	assert.Equal(t, "aichat load", records[2]["msg"])
+	assert.Equal(t, "chat-1", records[2]["chat_id"])
+	assert.Equal(t, "DEBUG", records[2]["level"])
+
+	assert.Equal(t, "aichat load", records[3]["msg"])
+	assert.Equal(t, "WARN", records[3]["level"])
+	assert.Contains(t, records[3]["error"], "failed to get session")
+}
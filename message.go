@@ -2,6 +2,7 @@ package aichat
 
 import (
 	"encoding/json"
+	"time"
 )
 
 // Message represents a chat message in the session
@@ -12,8 +13,91 @@ type Message struct {
 	Name       string     `json:"name,omitempty"`         // For tool responses
 	ToolCallID string     `json:"tool_call_id,omitempty"` // For tool responses
 
+	// ID identifies the message within its chat and ParentID links it to the
+	// previous message in a conversation tree. Created is the creation time.
+	// Like meta, they are persisted by Save/Load but not marshaled to LLMs.
+	ID       string    `json:"-"`
+	ParentID string    `json:"-"`
+	Created  time.Time `json:"-"`
+
+	// Reasoning holds the reasoning text returned by reasoning models
+	// (OpenRouter "reasoning", DeepSeek "reasoning_content").
+	// It is persisted by Save/Load but omitted when the message is marshaled.
+	Reasoning string `json:"reasoning,omitempty"`
+	// ReasoningDetails holds structured reasoning blocks, such as Anthropic
+	// thinking blocks with signatures. Like Reasoning, it is omitted when marshaled.
+	ReasoningDetails []ReasoningDetail `json:"reasoning_details,omitempty"`
+
 	// meta is not marshaled to LLM and other tools
 	meta map[string]any `json:"-"`
+	// tokens caches the token count of the message
+	tokens *tokenCount
+}
+
+// ensureID assigns the message an ID and creation time if they are not set
+func (m *Message) ensureID() {
+	if m.ID == "" {
+		m.ID = newMessageID()
+	}
+	if m.Created.IsZero() {
+		m.Created = time.Now()
+	}
+}
+
+// ReasoningDetail represents a structured reasoning block
+type ReasoningDetail struct {
+	// Type is the block type, e.g. "reasoning.text", "reasoning.summary" or "reasoning.encrypted"
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	Format    string `json:"format,omitempty"`
+	Index     int    `json:"index,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Data holds encrypted or redacted reasoning
+	Data string `json:"data,omitempty"`
+}
+
+// message is an alias of Message without custom JSON methods
+type message Message
+
+// MarshalJSON implements the json.Marshaler interface.
+// Reasoning fields are omitted since most providers reject them in requests;
+// use WithReasoning for providers that require reasoning to be echoed back.
+func (m Message) MarshalJSON() ([]byte, error) {
+	m.Reasoning = ""
+	m.ReasoningDetails = nil
+	return json.Marshal(message(m))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// DeepSeek "reasoning_content" is accepted as an alias of "reasoning".
+func (m *Message) UnmarshalJSON(data []byte) error {
+	v := struct {
+		message
+		ReasoningContent string `json:"reasoning_content,omitempty"`
+	}{message: message(*m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = Message(v.message)
+	if m.Reasoning == "" {
+		m.Reasoning = v.ReasoningContent
+	}
+	return nil
+}
+
+// ReasoningMessage is a Message that keeps its reasoning fields when marshaled
+type ReasoningMessage Message
+
+// WithReasoning converts messages for providers that require reasoning,
+// such as thinking block signatures, to be echoed back in requests.
+func WithReasoning(messages []*Message) []*ReasoningMessage {
+	out := make([]*ReasoningMessage, len(messages))
+	for i, m := range messages {
+		out[i] = (*ReasoningMessage)(m)
+	}
+	return out
 }
 
 // Meta represents metadata for a message.
@@ -66,22 +150,23 @@ func (m *Message) ContentString() string {
 	return v
 }
 
-// Part represents a part of a message content that can be either text or image
-type Part struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	ImageURL struct {
-		URL    string `json:"url"`
-		Detail string `json:"detail,omitempty"`
-	} `json:"image_url,omitempty"`
-}
-
-// ContentParts returns the parts of a multipart message content (text and images).
+// ContentParts returns the parts of a multipart message content.
 // Returns nil for both parts and error if the content is not multipart.
 // Returns error if the content cannot be properly marshaled/unmarshaled.
 func (m *Message) ContentParts() ([]*Part, error) {
-	d, ok := m.Content.([]any)
-	if !ok {
+	var d []any
+	switch content := m.Content.(type) {
+	case []*Part:
+		return content, nil
+	case []Part:
+		p := make([]*Part, len(content))
+		for i := range content {
+			p[i] = &content[i]
+		}
+		return p, nil
+	case []any:
+		d = content
+	default:
 		return nil, nil
 	}
 	p := []*Part{}
@@ -93,3 +178,8 @@ func (m *Message) ContentParts() ([]*Part, error) {
 	}
 	return nil, err
 }
+
+// SetContentParts sets the content of the message to the given parts
+func (m *Message) SetContentParts(parts ...*Part) {
+	m.Content = parts
+}
@@ -59,3 +59,36 @@ func TestMessage_Json(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `{"role":"user","content":"Hello, world!"}`, string(jsonBytes))
 }
+
+func TestMessage_Reasoning(t *testing.T) {
+	msg := &aichat.Message{
+		Role:      "assistant",
+		Content:   "4",
+		Reasoning: "2+2=4",
+		ReasoningDetails: []aichat.ReasoningDetail{
+			{Type: "reasoning.text", Text: "2+2=4", Signature: "sig"},
+		},
+	}
+
+	// Reasoning is omitted from outbound messages by default
+	jsonBytes, err := json.Marshal(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"role":"assistant","content":"4"}`, string(jsonBytes))
+
+	// Reasoning is echoed when requested
+	jsonBytes, err = json.Marshal(aichat.WithReasoning([]*aichat.Message{msg}))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"role":"assistant","content":"4","reasoning":"2+2=4","reasoning_details":[{"type":"reasoning.text","text":"2+2=4","signature":"sig"}]}]`, string(jsonBytes))
+
+	// Reasoning is decoded from OpenRouter and DeepSeek responses
+	decoded := new(aichat.Message)
+	assert.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":"4","reasoning":"openrouter"}`), decoded))
+	assert.Equal(t, "openrouter", decoded.Reasoning)
+
+	decoded = new(aichat.Message)
+	assert.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":"4","reasoning_content":"deepseek"}`), decoded))
+	assert.Equal(t, "deepseek", decoded.Reasoning)
+	assert.Equal(t, "4", decoded.Content)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"role":1}`), decoded))
+}
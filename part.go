@@ -0,0 +1,138 @@
+package aichat
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Part types supported in multipart message content
+const (
+	PartTypeText       = "text"
+	PartTypeImageURL   = "image_url"
+	PartTypeInputAudio = "input_audio"
+	PartTypeFile       = "file"
+	PartTypeVideoURL   = "video_url"
+	PartTypeToolResult = "tool_result"
+)
+
+// Part represents a part of a message content.
+// Type selects which of the other fields is set.
+type Part struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *File       `json:"file,omitempty"`
+	VideoURL   *VideoURL   `json:"video_url,omitempty"`
+	ToolResult *ToolResult `json:"tool_result,omitempty"`
+	// Attachment replaces the inline data of image, audio, file and video parts
+	// stored in an AttachmentStore
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
+
+// ImageURL references an image by URL or data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// InputAudio holds base64-encoded audio data
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"` // e.g. "wav" or "mp3"
+}
+
+// File references a document (PDF, etc.) by data URL or by a provider file ID
+type File struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"` // data URL
+	FileID   string `json:"file_id,omitempty"`
+}
+
+// VideoURL references a video by URL or data URL
+type VideoURL struct {
+	URL string `json:"url"`
+}
+
+// ToolResult holds a tool result carried as a content part
+type ToolResult struct {
+	ToolCallID string `json:"tool_call_id"`
+	Content    any    `json:"content"` // string or []*Part
+	IsError    bool   `json:"is_error,omitempty"`
+}
+
+// TextPart creates a text part
+func TextPart(text string) *Part {
+	return &Part{Type: PartTypeText, Text: text}
+}
+
+// ImagePart creates an image part from a URL
+func ImagePart(url string) *Part {
+	return &Part{Type: PartTypeImageURL, ImageURL: &ImageURL{URL: url}}
+}
+
+// ImagePartFromBytes creates an image part with the image inlined as a data URL
+func ImagePartFromBytes(mimeType string, data []byte) *Part {
+	return ImagePart(DataURL(mimeType, data))
+}
+
+// AudioPart creates an input audio part in the given format (e.g. "wav" or "mp3")
+func AudioPart(format string, data []byte) *Part {
+	return &Part{Type: PartTypeInputAudio, InputAudio: &InputAudio{
+		Data:   base64.StdEncoding.EncodeToString(data),
+		Format: format,
+	}}
+}
+
+// FilePart creates a file part with the file inlined as a data URL
+func FilePart(filename string, mimeType string, data []byte) *Part {
+	return &Part{Type: PartTypeFile, File: &File{
+		Filename: filename,
+		FileData: DataURL(mimeType, data),
+	}}
+}
+
+// FileIDPart creates a file part referencing a file previously uploaded to the provider
+func FileIDPart(fileID string) *Part {
+	return &Part{Type: PartTypeFile, File: &File{FileID: fileID}}
+}
+
+// VideoPart creates a video part from a URL
+func VideoPart(url string) *Part {
+	return &Part{Type: PartTypeVideoURL, VideoURL: &VideoURL{URL: url}}
+}
+
+// ToolResultPart creates a tool result part for the given tool call
+func ToolResultPart(toolCallID string, content any) *Part {
+	return &Part{Type: PartTypeToolResult, ToolResult: &ToolResult{
+		ToolCallID: toolCallID,
+		Content:    content,
+	}}
+}
+
+// DataURL encodes data as a base64 data URL
+func DataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// ParseDataURL decodes a data URL into its MIME type and data
+func ParseDataURL(url string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", nil, fmt.Errorf("not a data URL")
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid data URL")
+	}
+	mimeType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		return mimeType, []byte(data), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid data URL: %w", err)
+	}
+	return mimeType, b, nil
+}
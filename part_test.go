@@ -0,0 +1,120 @@
+package aichat_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestPartJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		part *aichat.Part
+		want string
+	}{
+		{
+			name: "text",
+			part: aichat.TextPart("Hello"),
+			want: `{"type":"text","text":"Hello"}`,
+		},
+		{
+			name: "image url",
+			part: aichat.ImagePart("https://example.com/cat.jpg"),
+			want: `{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}`,
+		},
+		{
+			name: "image bytes",
+			part: aichat.ImagePartFromBytes("image/png", []byte("png")),
+			want: `{"type":"image_url","image_url":{"url":"data:image/png;base64,cG5n"}}`,
+		},
+		{
+			name: "audio",
+			part: aichat.AudioPart("wav", []byte("wav")),
+			want: `{"type":"input_audio","input_audio":{"data":"d2F2","format":"wav"}}`,
+		},
+		{
+			name: "file data",
+			part: aichat.FilePart("doc.pdf", "application/pdf", []byte("pdf")),
+			want: `{"type":"file","file":{"filename":"doc.pdf","file_data":"data:application/pdf;base64,cGRm"}}`,
+		},
+		{
+			name: "file id",
+			part: aichat.FileIDPart("file-123"),
+			want: `{"type":"file","file":{"file_id":"file-123"}}`,
+		},
+		{
+			name: "video",
+			part: aichat.VideoPart("https://example.com/clip.mp4"),
+			want: `{"type":"video_url","video_url":{"url":"https://example.com/clip.mp4"}}`,
+		},
+		{
+			name: "tool result",
+			part: aichat.ToolResultPart("call-1", "42"),
+			want: `{"type":"tool_result","tool_result":{"tool_call_id":"call-1","content":"42"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.part)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+
+			decoded := new(aichat.Part)
+			require.NoError(t, json.Unmarshal(b, decoded))
+			b2, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(b2))
+		})
+	}
+}
+
+func TestSetContentParts(t *testing.T) {
+	msg := &aichat.Message{Role: "user"}
+	msg.SetContentParts(aichat.TextPart("Look"), aichat.ImagePart("https://example.com/cat.jpg"))
+
+	parts, err := msg.ContentParts()
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "Look", parts[0].Text)
+	assert.Equal(t, "https://example.com/cat.jpg", parts[1].ImageURL.URL)
+
+	b, err := json.Marshal(msg)
+	require.NoError(t, err)
+	assert.Equal(t, `{"role":"user","content":[{"type":"text","text":"Look"},{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]}`, string(b))
+
+	// Parts survive a JSON round trip as []any content
+	decoded := new(aichat.Message)
+	require.NoError(t, json.Unmarshal(b, decoded))
+	parts, err = decoded.ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, []*aichat.Part{aichat.TextPart("Look"), aichat.ImagePart("https://example.com/cat.jpg")}, parts)
+
+	msg.Content = []aichat.Part{*aichat.TextPart("value")}
+	parts, err = msg.ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, []*aichat.Part{aichat.TextPart("value")}, parts)
+}
+
+func TestParseDataURL(t *testing.T) {
+	mimeType, data, err := aichat.ParseDataURL(aichat.DataURL("image/png", []byte("png")))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", mimeType)
+	assert.Equal(t, []byte("png"), data)
+
+	mimeType, data, err = aichat.ParseDataURL("data:text/plain,hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", mimeType)
+	assert.Equal(t, []byte("hello"), data)
+
+	_, _, err = aichat.ParseDataURL("https://example.com/cat.jpg")
+	assert.Error(t, err)
+	_, _, err = aichat.ParseDataURL("data:image/png;base64")
+	assert.Error(t, err)
+	_, _, err = aichat.ParseDataURL("data:image/png;base64,!!!")
+	assert.Error(t, err)
+}
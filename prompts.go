@@ -0,0 +1,201 @@
+package aichat
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// MetaPrompts is the chat meta key recording the prompt versions assigned to the chat,
+// as a map from prompt name to version
+const MetaPrompts = "prompts"
+
+// PromptRegistry stores versions of named prompt templates and assigns versions to chats
+// for prompt experiments. A chat is assigned a version deterministically from its ID and
+// the version weights, and the assignment is recorded in the chat Meta under MetaPrompts,
+// so that a persisted chat keeps its version and outcomes can be compared across chats.
+// A PromptRegistry is safe for concurrent use.
+type PromptRegistry struct {
+	mu        sync.RWMutex
+	templates *Templates
+	prompts   map[string][]*promptVersion
+}
+
+// promptVersion is a registered version of a prompt
+type promptVersion struct {
+	version string
+	weight  int
+}
+
+// NewPromptRegistry returns an empty prompt registry
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{templates: NewTemplates(), prompts: make(map[string][]*promptVersion)}
+}
+
+// Register adds or replaces a version of the prompt name with the template text.
+// Weight is the relative share of chats assigned the version; versions with weight 0
+// are never assigned to new chats but still serve chats they were assigned to before.
+func (r *PromptRegistry) Register(name, version, text string, weight int) error {
+	if name == "" || version == "" {
+		return fmt.Errorf("prompt name and version are required")
+	}
+	if weight < 0 {
+		return fmt.Errorf("prompt %s version %s: negative weight %d", name, version, weight)
+	}
+	if err := r.templates.Add(promptTemplateName(name, version), text); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v := r.find(name, version); v != nil {
+		v.weight = weight
+		return nil
+	}
+	r.prompts[name] = append(r.prompts[name], &promptVersion{version: version, weight: weight})
+	return nil
+}
+
+// SetWeight changes the weight of a registered version, e.g. to ramp up or retire it
+func (r *PromptRegistry) SetWeight(name, version string, weight int) error {
+	if weight < 0 {
+		return fmt.Errorf("prompt %s version %s: negative weight %d", name, version, weight)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := r.find(name, version)
+	if v == nil {
+		return fmt.Errorf("prompt %s version %s not found", name, version)
+	}
+	v.weight = weight
+	return nil
+}
+
+// Versions returns the registered versions of the prompt name in registration order
+func (r *PromptRegistry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := make([]string, 0, len(r.prompts[name]))
+	for _, v := range r.prompts[name] {
+		versions = append(versions, v.version)
+	}
+	return versions
+}
+
+// find returns the registered version, or nil. It must be called with r.mu held.
+func (r *PromptRegistry) find(name, version string) *promptVersion {
+	for _, v := range r.prompts[name] {
+		if v.version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// Assign returns the version of the prompt name assigned to the chat. A version already
+// recorded in the chat Meta is kept if it is still registered; otherwise a version is picked
+// from a hash of the chat ID and prompt name according to the weights and recorded.
+func (r *PromptRegistry) Assign(chat *Chat, name string) (string, error) {
+	if version := chat.PromptVersion(name); version != "" {
+		r.mu.RLock()
+		registered := r.find(name, version) != nil
+		r.mu.RUnlock()
+		if registered {
+			return version, nil
+		}
+	}
+	if chat.ID == "" {
+		return "", fmt.Errorf("chat ID is required to assign prompt %s", name)
+	}
+
+	r.mu.RLock()
+	versions := slices.Clone(r.prompts[name])
+	r.mu.RUnlock()
+	total := 0
+	for _, v := range versions {
+		total += v.weight
+	}
+	if total == 0 {
+		return "", fmt.Errorf("prompt %s has no versions with weight", name)
+	}
+
+	sum := sha256.Sum256([]byte(chat.ID + "\x00" + name))
+	n := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	version := ""
+	for _, v := range versions {
+		if n < v.weight {
+			version = v.version
+			break
+		}
+		n -= v.weight
+	}
+	chat.setPromptVersion(name, version)
+	return version, nil
+}
+
+// RenderMessage renders a version of the prompt name into a message with the given role,
+// recording the prompt name and version in the message meta under MetaTemplate
+func (r *PromptRegistry) RenderMessage(role, name, version string, data any) (*Message, error) {
+	msg, err := r.templates.RenderMessage(role, promptTemplateName(name, version), data)
+	if err != nil {
+		return nil, err
+	}
+	info := msg.Template()
+	info.Name, info.Version = name, version
+	msg.Meta().Set(MetaTemplate, *info)
+	return msg, nil
+}
+
+func promptTemplateName(name, version string) string {
+	return name + "@" + version
+}
+
+// PromptVersion returns the version of the prompt name recorded in the chat Meta, or ""
+func (chat *Chat) PromptVersion(name string) string {
+	switch prompts := chat.Meta[MetaPrompts].(type) {
+	case map[string]string:
+		return prompts[name]
+	case map[string]any:
+		// After a Save/Load round trip
+		version, _ := prompts[name].(string)
+		return version
+	}
+	return ""
+}
+
+func (chat *Chat) setPromptVersion(name, version string) {
+	if chat.Meta == nil {
+		chat.Meta = make(map[string]any)
+	}
+	prompts := make(map[string]any)
+	switch existing := chat.Meta[MetaPrompts].(type) {
+	case map[string]string:
+		for k, v := range existing {
+			prompts[k] = v
+		}
+	case map[string]any:
+		prompts = existing
+	}
+	prompts[name] = version
+	chat.Meta[MetaPrompts] = prompts
+}
+
+// SetSystemPrompt assigns the chat a version of the prompt name from Options.Prompts,
+// renders it with data and sets it as the system message. The prompt name, version and
+// variables are recorded in the message meta under MetaTemplate.
+func (chat *Chat) SetSystemPrompt(name string, data any) (*Message, error) {
+	registry := chat.Options.Prompts
+	if registry == nil {
+		return nil, fmt.Errorf("prompt registry not initialized in options")
+	}
+	version, err := registry.Assign(chat, name)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := registry.RenderMessage("system", name, version, data)
+	if err != nil {
+		return nil, err
+	}
+	return chat.SetSystemMessage(msg), nil
+}
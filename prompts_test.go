@@ -0,0 +1,109 @@
+package aichat_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func newTestRegistry(t *testing.T) *aichat.PromptRegistry {
+	t.Helper()
+	r := aichat.NewPromptRegistry()
+	require.NoError(t, r.Register("support", "v1", "You are a support agent for {{.Product}}.", 1))
+	require.NoError(t, r.Register("support", "v2", "You help {{.Product}} customers. Be brief.", 3))
+	return r
+}
+
+func TestPromptRegistryAssign(t *testing.T) {
+	r := newTestRegistry(t)
+	assert.Equal(t, []string{"v1", "v2"}, r.Versions("support"))
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		chat := &aichat.Chat{ID: fmt.Sprintf("chat-%d", i)}
+		version, err := r.Assign(chat, "support")
+		require.NoError(t, err)
+		counts[version]++
+
+		// Deterministic from the chat ID
+		again, err := r.Assign(&aichat.Chat{ID: chat.ID}, "support")
+		require.NoError(t, err)
+		assert.Equal(t, version, again)
+		assert.Equal(t, version, chat.PromptVersion("support"))
+	}
+	assert.InDelta(t, 500, counts["v1"], 100)
+	assert.InDelta(t, 1500, counts["v2"], 100)
+}
+
+func TestPromptRegistryKeepsAssignment(t *testing.T) {
+	r := newTestRegistry(t)
+	chat := &aichat.Chat{ID: "chat-1", Meta: map[string]any{aichat.MetaPrompts: map[string]any{"support": "v1"}}}
+
+	// A retired version still serves the chats it was assigned to
+	require.NoError(t, r.SetWeight("support", "v1", 0))
+	version, err := r.Assign(chat, "support")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", version)
+
+	// New chats only get versions with weight
+	for i := 0; i < 50; i++ {
+		version, err := r.Assign(&aichat.Chat{ID: fmt.Sprintf("new-%d", i)}, "support")
+		require.NoError(t, err)
+		assert.Equal(t, "v2", version)
+	}
+
+	// An assignment to an unknown version is replaced
+	chat.Meta[aichat.MetaPrompts] = map[string]any{"support": "v0", "other": "x"}
+	version, err = r.Assign(chat, "support")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", version)
+	assert.Equal(t, map[string]any{"support": "v2", "other": "x"}, chat.Meta[aichat.MetaPrompts])
+}
+
+func TestPromptRegistryErrors(t *testing.T) {
+	r := newTestRegistry(t)
+	_, err := r.Assign(&aichat.Chat{}, "support")
+	assert.ErrorContains(t, err, "chat ID is required")
+	_, err = r.Assign(&aichat.Chat{ID: "x"}, "unknown")
+	assert.ErrorContains(t, err, "no versions with weight")
+
+	assert.Error(t, r.Register("", "v1", "text", 1))
+	assert.Error(t, r.Register("support", "v3", "text", -1))
+	assert.Error(t, r.Register("support", "v3", "{{.Broken", 1))
+	assert.Error(t, r.SetWeight("support", "v9", 1))
+	assert.Equal(t, []string{"v1", "v2"}, r.Versions("support"))
+}
+
+func TestSetSystemPrompt(t *testing.T) {
+	r := newTestRegistry(t)
+	chat := &aichat.Chat{ID: "chat-42", Options: aichat.Options{S3: newMockS3(), Prompts: r}}
+
+	msg, err := chat.SetSystemPrompt("support", map[string]any{"Product": "Acme"})
+	require.NoError(t, err)
+	version := chat.PromptVersion("support")
+	require.NotEmpty(t, version)
+	info := msg.Template()
+	require.NotNil(t, info)
+	assert.Equal(t, "support", info.Name)
+	assert.Equal(t, version, info.Version)
+	want := map[string]string{
+		"v1": "You are a support agent for Acme.",
+		"v2": "You help Acme customers. Be brief.",
+	}[version]
+	assert.Equal(t, want, msg.Content)
+
+	// The assignment survives Save/Load
+	require.NoError(t, chat.Save(context.Background(), "chat-42"))
+	loaded := &aichat.Chat{Options: chat.Options}
+	require.NoError(t, loaded.Load(context.Background(), "chat-42"))
+	assert.Equal(t, version, loaded.PromptVersion("support"))
+	assert.Equal(t, version, loaded.Messages[0].Template().Version)
+
+	_, err = (&aichat.Chat{ID: "x"}).SetSystemPrompt("support", nil)
+	assert.ErrorContains(t, err, "prompt registry not initialized")
+}
@@ -0,0 +1,231 @@
+package aichat
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Detector finds one kind of sensitive value in text
+type Detector struct {
+	// Kind names the placeholders of detected values, e.g. "EMAIL" for [EMAIL_1]
+	Kind string
+	// Pattern matches candidate values
+	Pattern *regexp.Regexp
+	// Valid optionally rejects false positives among the matches
+	Valid func(match string) bool
+}
+
+var (
+	apiKeyPattern = regexp.MustCompile(`(?i)\b(?:sk|pk|rk)-[a-z0-9_-]{16,}|\bAIza[0-9A-Za-z_-]{35}\b|\b(?:ghp|gho|ghs|github_pat)_[0-9A-Za-z_]{20,}|\bxox[abpr]-[0-9A-Za-z-]{10,}|\bAKIA[0-9A-Z]{16}\b|(?i:bearer)\s+[0-9A-Za-z._~+/-]{16,}=*`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern  = regexp.MustCompile(`\+\d{7,15}\b|(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.-])\d{3}[\s.-]\d{4}\b`)
+	cardPattern   = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+	placeholderPattern = regexp.MustCompile(`\[[A-Z][A-Z_]*_\d+\]`)
+)
+
+// Built-in detectors
+var (
+	EmailDetector      = Detector{Kind: "EMAIL", Pattern: emailPattern}
+	PhoneDetector      = Detector{Kind: "PHONE", Pattern: phonePattern}
+	CreditCardDetector = Detector{Kind: "CARD", Pattern: cardPattern, Valid: luhnValid}
+	APIKeyDetector     = Detector{Kind: "API_KEY", Pattern: apiKeyPattern}
+)
+
+// DefaultDetectors are the detectors used when Redactor.Detectors or Logging.Detectors is nil.
+// Credit cards are detected before phone numbers so that card digits are not taken for phones.
+var DefaultDetectors = []Detector{APIKeyDetector, EmailDetector, CreditCardDetector, PhoneDetector}
+
+// replace replaces the values found in s with the result of fn
+func (d Detector) replace(s string, fn func(match string) string) string {
+	return d.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if d.Valid != nil && !d.Valid(match) {
+			return match
+		}
+		return fn(match)
+	})
+}
+
+// Mask replaces the values found in s with [REDACTED_<Kind>], irreversibly
+func (d Detector) Mask(s string) string {
+	mask := "[REDACTED_" + d.Kind + "]"
+	return d.replace(s, func(string) string { return mask })
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// Redactor replaces secrets and PII in messages with placeholders such as [EMAIL_1].
+// The same value always maps to the same placeholder, and the mapping is kept so that
+// placeholders in replies can be restored for the end user. The mapping lives only in
+// the Redactor; use one Redactor per conversation.
+type Redactor struct {
+	// Detectors find the values to redact, in order (default DefaultDetectors)
+	Detectors []Detector
+
+	mu     sync.Mutex
+	tokens map[string]string // placeholder -> value
+	values map[string]string // value -> placeholder
+	counts map[string]int    // kind -> placeholders issued
+}
+
+// NewRedactor returns a Redactor using the given detectors, or DefaultDetectors if none
+func NewRedactor(detectors ...Detector) *Redactor {
+	return &Redactor{Detectors: detectors}
+}
+
+// RedactString replaces detected values in s with placeholders
+func (r *Redactor) RedactString(s string) string {
+	detectors := r.Detectors
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range detectors {
+		s = d.replace(s, func(match string) string {
+			return r.placeholder(d.Kind, match)
+		})
+	}
+	return s
+}
+
+// placeholder returns the placeholder of value, issuing one if needed. It must be called with r.mu held.
+func (r *Redactor) placeholder(kind, value string) string {
+	if p, ok := r.values[value]; ok {
+		return p
+	}
+	if r.tokens == nil {
+		r.tokens = make(map[string]string)
+		r.values = make(map[string]string)
+		r.counts = make(map[string]int)
+	}
+	r.counts[kind]++
+	p := fmt.Sprintf("[%s_%d]", kind, r.counts[kind])
+	r.tokens[p] = value
+	r.values[value] = p
+	return p
+}
+
+// Restore replaces the placeholders issued by the Redactor in s with the original values.
+// Unknown placeholders are left as is.
+func (r *Redactor) Restore(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+		if v, ok := r.tokens[p]; ok {
+			return v
+		}
+		return p
+	})
+}
+
+// Tokens returns a copy of the placeholder to value mapping
+func (r *Redactor) Tokens() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tokens := make(map[string]string, len(r.tokens))
+	for p, v := range r.tokens {
+		tokens[p] = v
+	}
+	return tokens
+}
+
+// RedactMessage returns a copy of msg with detected values replaced in the content
+// (strings, text parts and tool result parts) and tool call arguments.
+// Tool results are covered as the content of tool messages.
+func (r *Redactor) RedactMessage(msg *Message) *Message {
+	return mapMessageText(msg, r.RedactString)
+}
+
+// RedactMessages returns redacted copies of msgs
+func (r *Redactor) RedactMessages(msgs []*Message) []*Message {
+	out := make([]*Message, len(msgs))
+	for i, msg := range msgs {
+		out[i] = r.RedactMessage(msg)
+	}
+	return out
+}
+
+// RestoreMessage returns a copy of msg with placeholders restored in the content and
+// tool call arguments, so that replies can be shown to the user and tools run on real values
+func (r *Redactor) RestoreMessage(msg *Message) *Message {
+	return mapMessageText(msg, r.Restore)
+}
+
+// Completer returns a Completer that redacts the request messages sent to client
+// and restores the placeholders in its replies
+func (r *Redactor) Completer(client Completer) Completer {
+	return CompleterFunc(func(ctx context.Context, req *CompletionRequest) (*Message, error) {
+		redacted := *req
+		redacted.Messages = r.RedactMessages(req.Messages)
+		msg, err := client.Complete(ctx, &redacted)
+		if msg == nil {
+			return msg, err
+		}
+		return r.RestoreMessage(msg), err
+	})
+}
+
+// mapMessageText returns a copy of msg with fn applied to its text.
+// The copy shares meta with msg.
+func mapMessageText(msg *Message, fn func(string) string) *Message {
+	if msg == nil {
+		return nil
+	}
+	c := *msg
+	c.Content = mapContentText(msg.Content, fn)
+	if len(msg.ToolCalls) > 0 {
+		c.ToolCalls = make([]ToolCall, len(msg.ToolCalls))
+		for i, call := range msg.ToolCalls {
+			call.Function.Arguments = fn(call.Function.Arguments)
+			c.ToolCalls[i] = call
+		}
+	}
+	return &c
+}
+
+// mapContentText applies fn to string content and to text and tool result parts.
+// Other content is returned unchanged.
+func mapContentText(content any, fn func(string) string) any {
+	if s, ok := content.(string); ok {
+		return fn(s)
+	}
+	parts, err := (&Message{Content: content}).ContentParts()
+	if err != nil || parts == nil {
+		return content
+	}
+	out := make([]*Part, len(parts))
+	for i, p := range parts {
+		c := *p
+		switch {
+		case c.Type == PartTypeText:
+			c.Text = fn(c.Text)
+		case c.ToolResult != nil:
+			tr := *c.ToolResult
+			tr.Content = mapContentText(tr.Content, fn)
+			c.ToolResult = &tr
+		}
+		out[i] = &c
+	}
+	return out
+}
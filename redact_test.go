@@ -0,0 +1,121 @@
+package aichat_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"email", "Contact alice@example.com today", "Contact [EMAIL_1] today"},
+		{"phone", "Call (555) 123-4567 or +1 555-987-6543", "Call [PHONE_1] or [PHONE_2]"},
+		{"e164 phone", "Text +447911123456", "Text [PHONE_1]"},
+		{"card", "Card 4111 1111 1111 1111 exp 12/29", "Card [CARD_1] exp 12/29"},
+		{"card fails luhn", "Order 4111 1111 1111 1112", "Order 4111 1111 1111 1112"},
+		{"api key", "key=sk-or-v1-abcdef0123456789abcdef", "key=[API_KEY_1]"},
+		{"nothing", "The weather on 2023-05-25 is sunny", "The weather on 2023-05-25 is sunny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, aichat.NewRedactor().RedactString(tt.in))
+		})
+	}
+}
+
+func TestRedactorReversible(t *testing.T) {
+	r := aichat.NewRedactor()
+	first := r.RedactString("alice@example.com and bob@example.com")
+	second := r.RedactString("again alice@example.com")
+	assert.Equal(t, "[EMAIL_1] and [EMAIL_2]", first)
+	assert.Equal(t, "again [EMAIL_1]", second, "the same value maps to the same placeholder")
+
+	assert.Equal(t, "I wrote to alice@example.com, not [EMAIL_9]", r.Restore("I wrote to [EMAIL_1], not [EMAIL_9]"))
+	assert.Equal(t, map[string]string{
+		"[EMAIL_1]": "alice@example.com",
+		"[EMAIL_2]": "bob@example.com",
+	}, r.Tokens())
+}
+
+func TestDetectorMask(t *testing.T) {
+	assert.Equal(t, "mail [REDACTED_EMAIL] or [REDACTED_EMAIL]",
+		aichat.EmailDetector.Mask("mail alice@example.com or bob@example.com"))
+	assert.Equal(t, "order 4111 1111 1111 1112", aichat.CreditCardDetector.Mask("order 4111 1111 1111 1112"),
+		"matches failing validation are kept")
+	assert.Equal(t, "card [REDACTED_CARD]", aichat.CreditCardDetector.Mask("card 4111 1111 1111 1111"))
+}
+
+func TestRedactorCustomDetector(t *testing.T) {
+	r := aichat.NewRedactor(aichat.Detector{Kind: "SSN", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)})
+	assert.Equal(t, "SSN [SSN_1], alice@example.com", r.RedactString("SSN 123-45-6789, alice@example.com"))
+}
+
+func TestRedactMessage(t *testing.T) {
+	r := aichat.NewRedactor()
+	chat := &aichat.Chat{}
+	user := chat.AddUserContent([]*aichat.Part{
+		aichat.TextPart("Email alice@example.com the receipt"),
+		aichat.ImagePart("https://example.com/receipt.png"),
+	})
+	call := chat.AddAssistantToolCall([]aichat.ToolCall{{
+		ID: "call_1", Type: "function",
+		Function: aichat.Function{Name: "send_email", Arguments: `{"to":"alice@example.com"}`},
+	}})
+	result := chat.AddToolRawContent("send_email", "call_1", `{"sent_to":"alice@example.com"}`)
+	parts := chat.AddUserContent([]*aichat.Part{aichat.ToolResultPart("call_2", "phone is 555-123-4567")})
+
+	redacted := r.RedactMessages(chat.Messages)
+	require.Len(t, redacted, 4)
+
+	userParts, err := redacted[0].ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, "Email [EMAIL_1] the receipt", userParts[0].Text)
+	assert.Equal(t, "https://example.com/receipt.png", userParts[1].ImageURL.URL)
+	assert.Equal(t, `{"to":"[EMAIL_1]"}`, redacted[1].ToolCalls[0].Function.Arguments)
+	assert.Equal(t, `{"sent_to":"[EMAIL_1]"}`, redacted[2].Content)
+	assert.Equal(t, "call_1", redacted[2].ToolCallID)
+	resultParts, err := redacted[3].ContentParts()
+	require.NoError(t, err)
+	assert.Equal(t, "phone is [PHONE_1]", resultParts[0].ToolResult.Content)
+
+	// The originals are unchanged
+	originalParts, _ := user.ContentParts()
+	assert.Equal(t, "Email alice@example.com the receipt", originalParts[0].Text)
+	assert.Equal(t, `{"to":"alice@example.com"}`, call.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, `{"sent_to":"alice@example.com"}`, result.Content)
+	originalResult, _ := parts.ContentParts()
+	assert.Equal(t, "phone is 555-123-4567", originalResult[0].ToolResult.Content)
+	assert.Equal(t, user.ID, redacted[0].ID)
+}
+
+func TestRedactorCompleter(t *testing.T) {
+	r := aichat.NewRedactor()
+	var sent []*aichat.Message
+	client := r.Completer(aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		sent = req.Messages
+		return &aichat.Message{Role: "assistant", Content: "Sending to [EMAIL_1]", ToolCalls: []aichat.ToolCall{{
+			ID: "call_1", Type: "function",
+			Function: aichat.Function{Name: "send_email", Arguments: `{"to":"[EMAIL_1]"}`},
+		}}}, nil
+	}))
+
+	chat := &aichat.Chat{}
+	chat.AddUserContent("Please email alice@example.com")
+	msg, err := client.Complete(context.Background(), chat.CompletionRequest("test/model"))
+	require.NoError(t, err)
+
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Please email [EMAIL_1]", sent[0].Content)
+	assert.Equal(t, "Please email alice@example.com", chat.Messages[0].Content)
+	assert.Equal(t, "Sending to alice@example.com", msg.Content)
+	assert.Equal(t, `{"to":"alice@example.com"}`, msg.ToolCalls[0].Function.Arguments)
+}
@@ -0,0 +1,187 @@
+package aichat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy retries transient provider errors with exponential backoff and jitter.
+// The zero value is usable and retries up to 3 attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first (default 3)
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry (default 500ms)
+	InitialBackoff time.Duration
+	// MaxBackoff caps the computed delay (default 30s). Retry-After is honored even if longer.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry (default 2)
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction (default 0.2, negative disables)
+	Jitter float64
+	// Retryable decides whether an error is retried (default IsRetryable)
+	Retryable func(err error) bool
+	// Sleep waits between attempts (default waits for the delay or ctx to be done)
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// DefaultRetryPolicy is used by Retry when the policy is nil
+var DefaultRetryPolicy = &RetryPolicy{}
+
+// Backoff returns the delay before retrying after the given failed attempt (1-based).
+// A Retry-After delay carried by err takes precedence over the computed backoff.
+func (p *RetryPolicy) Backoff(attempt int, err error) time.Duration {
+	if d := RetryAfter(err); d > 0 {
+		return d
+	}
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 500 * time.Millisecond
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	jitter := p.Jitter
+	if jitter == 0 {
+		jitter = 0.2
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	d = min(d, float64(maxBackoff))
+	if jitter > 0 {
+		d *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, or the attempts run out
+func (p *RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Retry(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Retry calls fn with the retry policy and returns its result.
+// A nil policy uses DefaultRetryPolicy.
+func Retry[T any](ctx context.Context, p *RetryPolicy, fn func(ctx context.Context) (T, error)) (T, error) {
+	if p == nil {
+		p = DefaultRetryPolicy
+	}
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := fn(ctx)
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return result, err
+		}
+		if serr := sleep(ctx, p.Backoff(attempt, err)); serr != nil {
+			return result, fmt.Errorf("retry interrupted: %w", errors.Join(serr, err))
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RetryTransport is an http.RoundTripper that retries requests failing with
+// transient errors, so that any HTTP client sending a Chat can use a RetryPolicy.
+// Non-2xx responses are converted with ErrorFromResponse to decide whether to retry;
+// the last response is returned unchanged. Requests with a body are only retried if they set GetBody,
+// as http.NewRequest does for in-memory bodies.
+type RetryTransport struct {
+	// Base is the underlying transport (default http.DefaultTransport)
+	Base http.RoundTripper
+	// Policy is the retry policy (default DefaultRetryPolicy)
+	Policy *RetryPolicy
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body cannot be replayed
+		return base.RoundTrip(req)
+	}
+	attempt := 0
+	resp, err := Retry(req.Context(), t.Policy, func(ctx context.Context) (*http.Response, error) {
+		attempt++
+		r := req
+		if attempt > 1 {
+			r = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+		resp, err := base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		// Classify a copy of the body and hand back a fresh one with the response
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		check := *resp
+		check.Body = io.NopCloser(bytes.NewReader(body))
+		perr := ErrorFromResponse(&check)
+		if t.retryable(perr) {
+			return resp, perr
+		}
+		return resp, nil
+	})
+	if err != nil && resp != nil && req.Context().Err() == nil {
+		// Attempts ran out on an error response
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *RetryTransport) retryable(err error) bool {
+	if t.Policy != nil && t.Policy.Retryable != nil {
+		return t.Policy.Retryable(err)
+	}
+	return IsRetryable(err)
+}
@@ -0,0 +1,128 @@
+package aichat_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &aichat.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: -1}
+	assert.Equal(t, time.Second, p.Backoff(1, nil))
+	assert.Equal(t, 2*time.Second, p.Backoff(2, nil))
+	assert.Equal(t, 4*time.Second, p.Backoff(3, nil))
+	assert.Equal(t, 5*time.Second, p.Backoff(4, nil))
+
+	// Retry-After takes precedence
+	err := aichat.NewProviderError(429, "", "")
+	err.RetryAfter = time.Minute
+	assert.Equal(t, time.Minute, p.Backoff(1, err))
+
+	// Jitter stays within bounds
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(1, nil)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	var slept []time.Duration
+	p := &aichat.RetryPolicy{
+		MaxAttempts: 4,
+		Jitter:      -1,
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		},
+	}
+
+	calls := 0
+	result, err := aichat.Retry(ctx, p, func(ctx context.Context) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", aichat.NewProviderError(503, "", "unavailable")
+		}
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result)
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, slept)
+
+	// Non-retryable errors are returned immediately
+	calls = 0
+	err = p.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return aichat.NewProviderError(401, "", "bad key")
+	})
+	assert.ErrorIs(t, err, aichat.ErrAuth)
+	assert.Equal(t, 1, calls)
+
+	// Attempts run out
+	calls = 0
+	err = p.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return aichat.NewProviderError(429, "", "")
+	})
+	assert.ErrorIs(t, err, aichat.ErrRateLimited)
+	assert.Equal(t, 4, calls)
+
+	// Cancellation interrupts the backoff
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = (&aichat.RetryPolicy{}).Do(cctx, func(ctx context.Context) error {
+		return aichat.NewProviderError(429, "", "")
+	})
+	assert.ErrorContains(t, err, "retry interrupted")
+	assert.ErrorIs(t, err, aichat.ErrRateLimited)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, aichat.IsRetryable(err))
+}
+
+func TestRetryTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"model":"m"}`, string(body))
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"id":"ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	noSleep := func(ctx context.Context, d time.Duration) error { return nil }
+	client := &http.Client{Transport: &aichat.RetryTransport{Policy: &aichat.RetryPolicy{Sleep: noSleep}}}
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"model":"m"}`))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, `{"id":"ok"}`, string(body))
+	assert.EqualValues(t, 3, calls.Load())
+
+	// The last error response is returned with its body when attempts run out
+	calls.Store(0)
+	client.Transport = &aichat.RetryTransport{Policy: &aichat.RetryPolicy{MaxAttempts: 2, Sleep: noSleep}}
+	resp, err = client.Post(server.URL, "application/json", strings.NewReader(`{"model":"m"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.EqualValues(t, 2, calls.Load())
+}
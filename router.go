@@ -0,0 +1,182 @@
+package aichat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MetaServedBy is the message meta key recording the provider and model that produced
+// an assistant message, along with the errors of any targets that were skipped
+const MetaServedBy = "served_by"
+
+// CompletionRequest is a provider-neutral chat completion request
+type CompletionRequest struct {
+	Model          string
+	Messages       []*Message
+	Tools          []*Tool
+	ResponseFormat *ResponseFormat
+	// Meta carries request metadata for middleware, typically the chat Meta.
+	// It is not sent to providers.
+	Meta map[string]any
+}
+
+// CompletionRequest returns a request for the chat messages and meta
+func (chat *Chat) CompletionRequest(model string, tools ...*Tool) *CompletionRequest {
+	return &CompletionRequest{
+		Model:    model,
+		Messages: chat.Messages,
+		Tools:    tools,
+		Meta:     chat.Meta,
+	}
+}
+
+// Completer sends a chat completion request and returns the assistant message
+type Completer interface {
+	Complete(ctx context.Context, req *CompletionRequest) (*Message, error)
+}
+
+// CompleterFunc adapts a function to the Completer interface
+type CompleterFunc func(ctx context.Context, req *CompletionRequest) (*Message, error)
+
+// Complete implements Completer
+func (fn CompleterFunc) Complete(ctx context.Context, req *CompletionRequest) (*Message, error) {
+	return fn(ctx, req)
+}
+
+// Target is a provider and model a Router can send requests to
+type Target struct {
+	// Provider names the provider in MetaServedBy
+	Provider string
+	// Client sends requests to the provider
+	Client Completer
+	// Model overrides the request model
+	Model string
+}
+
+// Route sends the requests it matches to its targets
+type Route struct {
+	Match   RouteMatcher
+	Targets []Target
+}
+
+// RouteMatcher reports whether a route applies to a request
+type RouteMatcher func(req *CompletionRequest) bool
+
+// Router is a Completer that routes requests by rules and falls back to the next
+// target when a target fails with one of the FallbackOn error classes
+type Router struct {
+	// Routes are checked in order; the targets of the first matching route are used.
+	// A route with a nil Match matches every request.
+	Routes []Route
+	// Targets are used when no route matches
+	Targets []Target
+	// FallbackOn lists the error classes that move on to the next target, matched with errors.Is
+	// (default: errors for which IsRetryable reports true, such as rate limits and server errors)
+	FallbackOn []error
+}
+
+// errEmptyResponse is the error of a target that returned neither a message nor an error
+var errEmptyResponse = errors.New("empty response")
+
+// Complete implements Completer. The returned message is tagged with MetaServedBy.
+// A target returning no message and no error is treated as failed and always falls back.
+func (r *Router) Complete(ctx context.Context, req *CompletionRequest) (*Message, error) {
+	targets := r.targets(req)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets for request")
+	}
+
+	var errs []error
+	var skipped []any
+	for _, target := range targets {
+		treq := *req
+		if target.Model != "" {
+			treq.Model = target.Model
+		}
+		msg, err := target.Client.Complete(ctx, &treq)
+		if err == nil && msg == nil {
+			err = errEmptyResponse
+		}
+		if err == nil {
+			served := map[string]any{"provider": target.Provider, "model": treq.Model}
+			if len(skipped) > 0 {
+				served["fallbacks"] = skipped
+			}
+			msg.Meta().Set(MetaServedBy, served)
+			return msg, nil
+		}
+		err = fmt.Errorf("%s %s: %w", target.Provider, treq.Model, err)
+		errs = append(errs, err)
+		if !r.fallback(ctx, err) {
+			break
+		}
+		skipped = append(skipped, map[string]any{
+			"provider": target.Provider, "model": treq.Model, "error": err.Error(),
+		})
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("all targets failed: %w", errors.Join(errs...))
+}
+
+func (r *Router) targets(req *CompletionRequest) []Target {
+	for _, route := range r.Routes {
+		if route.Match == nil || route.Match(req) {
+			return route.Targets
+		}
+	}
+	return r.Targets
+}
+
+func (r *Router) fallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, errEmptyResponse) {
+		return true
+	}
+	if len(r.FallbackOn) == 0 {
+		return IsRetryable(err)
+	}
+	for _, class := range r.FallbackOn {
+		if errors.Is(err, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// WhenTokensAbove matches requests whose messages and tools exceed n tokens.
+// A nil counter defaults to ApproxCounter.
+func WhenTokensAbove(n int, counter TokenCounter) RouteMatcher {
+	if counter == nil {
+		counter = ApproxCounter{}
+	}
+	return func(req *CompletionRequest) bool {
+		return CountRequestTokens(counter, req) > n
+	}
+}
+
+// WhenImages matches requests containing image parts
+func WhenImages() RouteMatcher {
+	return func(req *CompletionRequest) bool {
+		for _, msg := range req.Messages {
+			parts, _ := msg.ContentParts()
+			for _, p := range parts {
+				if p.Type == PartTypeImageURL {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// WhenTools matches requests that declare tools
+func WhenTools() RouteMatcher {
+	return func(req *CompletionRequest) bool {
+		return len(req.Tools) > 0
+	}
+}
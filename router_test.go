@@ -0,0 +1,152 @@
+package aichat_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+// fakeCompleter replies with its name or fails with err, recording the requested models
+type fakeCompleter struct {
+	name   string
+	err    error
+	models []string
+}
+
+func (f *fakeCompleter) Complete(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+	f.models = append(f.models, req.Model)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &aichat.Message{Role: "assistant", Content: f.name}, nil
+}
+
+func TestRouterFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeCompleter{name: "primary", err: aichat.NewProviderError(503, "", "down")}
+	secondary := &fakeCompleter{name: "secondary"}
+	router := &aichat.Router{Targets: []aichat.Target{
+		{Provider: "openai", Client: primary, Model: "gpt-4o"},
+		{Provider: "anthropic", Client: secondary, Model: "claude"},
+	}}
+
+	chat := new(aichat.Chat)
+	chat.AddUserContent("hello")
+	msg, err := router.Complete(ctx, &aichat.CompletionRequest{Model: "default", Messages: chat.Messages})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", msg.Content)
+	assert.Equal(t, []string{"gpt-4o"}, primary.models)
+	assert.Equal(t, []string{"claude"}, secondary.models)
+
+	served := msg.Meta().Get(aichat.MetaServedBy).(map[string]any)
+	assert.Equal(t, "anthropic", served["provider"])
+	assert.Equal(t, "claude", served["model"])
+	fallbacks := served["fallbacks"].([]any)
+	require.Len(t, fallbacks, 1)
+	assert.Equal(t, "openai", fallbacks[0].(map[string]any)["provider"])
+	assert.Contains(t, fallbacks[0].(map[string]any)["error"], "server error")
+
+	// Non-fallback errors are returned without trying other targets
+	primary.err = aichat.NewProviderError(400, "", "context length exceeded")
+	_, err = router.Complete(ctx, &aichat.CompletionRequest{})
+	assert.ErrorIs(t, err, aichat.ErrContextLengthExceeded)
+	assert.Len(t, secondary.models, 1)
+
+	// Configured error classes
+	router.FallbackOn = []error{aichat.ErrContextLengthExceeded}
+	msg, err = router.Complete(ctx, &aichat.CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", msg.Content)
+
+	// All targets failing
+	secondary.err = aichat.NewProviderError(400, "", "prompt is too long")
+	_, err = router.Complete(ctx, &aichat.CompletionRequest{})
+	assert.ErrorContains(t, err, "all targets failed")
+	assert.ErrorContains(t, err, "anthropic claude")
+	assert.ErrorIs(t, err, aichat.ErrContextLengthExceeded)
+
+	_, err = (&aichat.Router{}).Complete(ctx, &aichat.CompletionRequest{})
+	assert.Error(t, err)
+}
+
+func TestRouterEmptyResponse(t *testing.T) {
+	ctx := context.Background()
+	empty := aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return nil, nil
+	})
+	secondary := &fakeCompleter{name: "secondary"}
+	router := &aichat.Router{Targets: []aichat.Target{
+		{Provider: "a", Client: empty},
+		{Provider: "b", Client: secondary},
+	}, FallbackOn: []error{aichat.ErrServer}}
+	msg, err := router.Complete(ctx, &aichat.CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", msg.Content)
+
+	router.Targets = router.Targets[:1]
+	msg, err = router.Complete(ctx, &aichat.CompletionRequest{})
+	assert.Nil(t, msg)
+	assert.ErrorContains(t, err, "empty response")
+}
+
+func TestRouterCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	secondary := &fakeCompleter{name: "secondary"}
+	router := &aichat.Router{Targets: []aichat.Target{
+		{Provider: "a", Client: &fakeCompleter{err: errors.New("canceled")}},
+		{Provider: "b", Client: secondary},
+	}, FallbackOn: []error{aichat.ErrServer}}
+	_, err := router.Complete(ctx, &aichat.CompletionRequest{})
+	assert.Error(t, err)
+	assert.Empty(t, secondary.models)
+}
+
+func TestRouterRules(t *testing.T) {
+	ctx := context.Background()
+	vision := &fakeCompleter{name: "vision"}
+	long := &fakeCompleter{name: "long"}
+	tools := &fakeCompleter{name: "tools"}
+	fallback := &fakeCompleter{name: "default"}
+	router := &aichat.Router{
+		Routes: []aichat.Route{
+			{Match: aichat.WhenImages(), Targets: []aichat.Target{{Provider: "p", Client: vision}}},
+			{Match: aichat.WhenTokensAbove(100, nil), Targets: []aichat.Target{{Provider: "p", Client: long}}},
+			{Match: aichat.WhenTools(), Targets: []aichat.Target{{Provider: "p", Client: tools}}},
+		},
+		Targets: []aichat.Target{{Provider: "p", Client: fallback}},
+	}
+
+	image := &aichat.Message{Role: "user"}
+	image.SetContentParts(aichat.TextPart("what is this?"), aichat.ImagePart("https://example.com/a.png"))
+	tests := []struct {
+		name     string
+		req      *aichat.CompletionRequest
+		expected string
+	}{
+		{"images", &aichat.CompletionRequest{Messages: []*aichat.Message{image}}, "vision"},
+		{"tokens", &aichat.CompletionRequest{Messages: []*aichat.Message{{Role: "user", Content: strings.Repeat("word ", 200)}}}, "long"},
+		{"tools", &aichat.CompletionRequest{Tools: []*aichat.Tool{{Type: "function"}}}, "tools"},
+		{"default", &aichat.CompletionRequest{Messages: []*aichat.Message{{Role: "user", Content: "hi"}}}, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := router.Complete(ctx, tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, msg.Content)
+		})
+	}
+
+	// Routers are Completers and can be nested
+	var _ aichat.Completer = router
+	outer := &aichat.Router{Targets: []aichat.Target{{Provider: "router", Client: router}}}
+	msg, err := outer.Complete(ctx, &aichat.CompletionRequest{Tools: []*aichat.Tool{{}}})
+	require.NoError(t, err)
+	assert.Equal(t, "tools", msg.Content)
+}
@@ -0,0 +1,25 @@
+package googlegenai
+
+import (
+	"testing"
+
+	"github.com/presbrey/aichat"
+	"github.com/presbrey/aichat/schema/schematest"
+)
+
+func TestConformance(t *testing.T) {
+	schematest.Run(t, schematest.Config{
+		RoundTrip: func(chat *aichat.Chat) ([]*aichat.Message, error) {
+			system, contents, err := ConvertMessages(chat.Messages)
+			if err != nil {
+				return nil, err
+			}
+			return MessagesFromContents(system, contents)
+		},
+		// genai function calls have no IDs; they are synthesized on the way back.
+		// Reasoning is not sent to the model.
+		Lossy: []schematest.Feature{schematest.FeatureToolCallIDs, schematest.FeatureReasoning},
+		// Tool results are function responses in genai, never content parts
+		Unsupported: []schematest.Feature{schematest.FeatureToolResultParts},
+	})
+}
@@ -1,6 +1,8 @@
 package googlegenai
 
 import (
+	"fmt"
+
 	"github.com/google/generative-ai-go/genai"
 	"github.com/presbrey/aichat"
 )
@@ -57,3 +59,51 @@ func ToolToFunctionDeclaration(t *aichat.Tool) *genai.FunctionDeclaration {
 		Parameters:  schema,
 	}
 }
+
+// ConvertSchema converts an *aichat.Schema to a *genai.Schema.
+// Enum values are converted to strings.
+func ConvertSchema(s *aichat.Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	schema := &genai.Schema{
+		Type:        stringToGenAIType(s.Type),
+		Format:      s.Format,
+		Description: s.Description,
+		Items:       ConvertSchema(s.Items),
+		Required:    s.Required,
+		Nullable:    s.Nullable,
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for key, prop := range s.Properties {
+			schema.Properties[key] = ConvertSchema(prop)
+		}
+	}
+	for _, v := range s.Enum {
+		schema.Enum = append(schema.Enum, fmt.Sprint(v))
+	}
+	if len(schema.Enum) > 0 {
+		schema.Format = "enum"
+	}
+	return schema
+}
+
+// ApplyResponseFormat sets the response MIME type and schema of a generation config
+// from an *aichat.ResponseFormat, the Gemini equivalent of response_format
+func ApplyResponseFormat(config *genai.GenerationConfig, format *aichat.ResponseFormat) {
+	if format == nil {
+		return
+	}
+	switch format.Type {
+	case "json_object":
+		config.ResponseMIMEType = "application/json"
+	case "json_schema":
+		config.ResponseMIMEType = "application/json"
+		if format.JSONSchema != nil {
+			config.ResponseSchema = ConvertSchema(format.JSONSchema.Schema)
+		}
+	default:
+		config.ResponseMIMEType = "text/plain"
+	}
+}
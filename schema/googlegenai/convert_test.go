@@ -105,3 +105,38 @@ func TestConvertTools(t *testing.T) {
 	assert.Equal(t, "function1", result.FunctionDeclarations[0].Name)
 	assert.Equal(t, "function2", result.FunctionDeclarations[1].Name)
 }
+
+func TestApplyResponseFormat(t *testing.T) {
+	type answer struct {
+		Answer string   `json:"answer" description:"The answer"`
+		Tone   string   `json:"tone" enum:"formal,casual"`
+		Tags   []string `json:"tags,omitempty"`
+	}
+	format, err := aichat.NewResponseFormat[answer]("answer")
+	assert.NoError(t, err)
+
+	config := &genai.GenerationConfig{}
+	ApplyResponseFormat(config, format)
+	assert.Equal(t, "application/json", config.ResponseMIMEType)
+	assert.Equal(t, &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"answer": {Type: genai.TypeString, Description: "The answer"},
+			"tone":   {Type: genai.TypeString, Format: "enum", Enum: []string{"formal", "casual"}},
+			"tags":   {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		},
+		Required: []string{"answer", "tone"},
+	}, config.ResponseSchema)
+
+	config = &genai.GenerationConfig{}
+	ApplyResponseFormat(config, &aichat.ResponseFormat{Type: "json_object"})
+	assert.Equal(t, "application/json", config.ResponseMIMEType)
+	assert.Nil(t, config.ResponseSchema)
+
+	ApplyResponseFormat(config, &aichat.ResponseFormat{Type: "text"})
+	assert.Equal(t, "text/plain", config.ResponseMIMEType)
+
+	ApplyResponseFormat(config, nil)
+	assert.Equal(t, "text/plain", config.ResponseMIMEType)
+	assert.Nil(t, ConvertSchema(nil))
+}
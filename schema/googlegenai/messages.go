@@ -0,0 +1,283 @@
+package googlegenai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/presbrey/aichat"
+)
+
+// ConvertMessages converts []*aichat.Message to a genai system instruction and contents.
+// Consecutive tool messages are merged into a single user content of function responses.
+// Message reasoning is not sent; the genai SDK has no part type for it.
+func ConvertMessages(messages []*aichat.Message) (*genai.Content, []*genai.Content, error) {
+	var system *genai.Content
+	var contents []*genai.Content
+
+	// Tool call names by ID, for tool messages that omit the name
+	callNames := make(map[string]string)
+
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		switch msg.Role {
+		case "system":
+			parts, err := contentToParts(msg.Content)
+			if err != nil {
+				return nil, nil, err
+			}
+			if system == nil {
+				system = &genai.Content{}
+			}
+			system.Parts = append(system.Parts, parts...)
+
+		case "tool":
+			name := msg.Name
+			if name == "" {
+				name = callNames[msg.ToolCallID]
+			}
+			part := genai.FunctionResponse{
+				Name:     name,
+				Response: toolResultToResponse(msg.ContentString()),
+			}
+			last := len(contents) - 1
+			if last >= 0 && contents[last].Role == "user" && isFunctionResponses(contents[last]) {
+				contents[last].Parts = append(contents[last].Parts, part)
+			} else {
+				contents = append(contents, &genai.Content{Role: "user", Parts: []genai.Part{part}})
+			}
+
+		default:
+			parts, err := contentToParts(msg.Content)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, call := range msg.ToolCalls {
+				args, err := call.Function.ArgumentsMap()
+				if err != nil {
+					return nil, nil, err
+				}
+				callNames[call.ID] = call.Function.Name
+				parts = append(parts, genai.FunctionCall{Name: call.Function.Name, Args: args})
+			}
+			contents = append(contents, &genai.Content{Role: roleToGenAI(msg.Role), Parts: parts})
+		}
+	}
+	return system, contents, nil
+}
+
+// MessagesFromContents converts a genai system instruction and contents to []*aichat.Message.
+// genai function calls carry no IDs, so IDs are synthesized and function responses
+// are matched to calls of the same name in order.
+func MessagesFromContents(system *genai.Content, contents []*genai.Content) ([]*aichat.Message, error) {
+	var messages []*aichat.Message
+	if system != nil {
+		content, err := partsToContent(system.Parts)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &aichat.Message{Role: "system", Content: content})
+	}
+
+	// Synthesized call IDs waiting for a response, by function name
+	pending := make(map[string][]string)
+	n := 0
+
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		var rest []genai.Part
+		var calls []aichat.ToolCall
+		for _, p := range c.Parts {
+			switch p := p.(type) {
+			case genai.FunctionCall:
+				b, err := json.Marshal(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				n++
+				id := fmt.Sprintf("call_%d", n)
+				pending[p.Name] = append(pending[p.Name], id)
+				calls = append(calls, aichat.ToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: aichat.Function{Name: p.Name, Arguments: string(b)},
+				})
+			case genai.FunctionResponse:
+				var id string
+				if ids := pending[p.Name]; len(ids) > 0 {
+					id, pending[p.Name] = ids[0], ids[1:]
+				}
+				result, err := responseToToolResult(p.Response)
+				if err != nil {
+					return nil, err
+				}
+				messages = append(messages, &aichat.Message{
+					Role:       "tool",
+					Name:       p.Name,
+					ToolCallID: id,
+					Content:    result,
+				})
+			default:
+				rest = append(rest, p)
+			}
+		}
+		if len(rest) == 0 && len(calls) == 0 {
+			continue
+		}
+		content, err := partsToContent(rest)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &aichat.Message{
+			Role:      roleFromGenAI(c.Role),
+			Content:   content,
+			ToolCalls: calls,
+		})
+	}
+	return messages, nil
+}
+
+func roleToGenAI(role string) string {
+	if role == "assistant" {
+		return "model"
+	}
+	return "user"
+}
+
+func roleFromGenAI(role string) string {
+	if role == "model" {
+		return "assistant"
+	}
+	return "user"
+}
+
+func isFunctionResponses(c *genai.Content) bool {
+	for _, p := range c.Parts {
+		if _, ok := p.(genai.FunctionResponse); !ok {
+			return false
+		}
+	}
+	return len(c.Parts) > 0
+}
+
+// toolResultToResponse decodes a JSON object tool result, wrapping anything else as {"content": result}
+func toolResultToResponse(result string) map[string]any {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(result), &m); err == nil && m != nil {
+		return m
+	}
+	return map[string]any{"content": result}
+}
+
+// responseToToolResult reverses toolResultToResponse
+func responseToToolResult(response map[string]any) (string, error) {
+	if s, ok := response["content"].(string); ok && len(response) == 1 {
+		return s, nil
+	}
+	b, err := json.Marshal(response)
+	return string(b), err
+}
+
+// contentToParts converts message content (a string or multipart) to genai parts
+func contentToParts(content any) ([]genai.Part, error) {
+	if s, ok := content.(string); ok {
+		if s == "" {
+			return nil, nil
+		}
+		return []genai.Part{genai.Text(s)}, nil
+	}
+	msg := &aichat.Message{Content: content}
+	parts, err := msg.ContentParts()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]genai.Part, 0, len(parts))
+	for _, p := range parts {
+		var part genai.Part
+		switch {
+		case p.Type == aichat.PartTypeText:
+			part = genai.Text(p.Text)
+		case p.Type == aichat.PartTypeImageURL && p.ImageURL != nil:
+			part, err = urlToPart(p.ImageURL.URL)
+		case p.Type == aichat.PartTypeVideoURL && p.VideoURL != nil:
+			part, err = urlToPart(p.VideoURL.URL)
+		case p.Type == aichat.PartTypeInputAudio && p.InputAudio != nil:
+			var b []byte
+			b, err = base64.StdEncoding.DecodeString(p.InputAudio.Data)
+			part = genai.Blob{MIMEType: "audio/" + p.InputAudio.Format, Data: b}
+		case p.Type == aichat.PartTypeFile && p.File != nil && p.File.FileData != "":
+			part, err = urlToPart(p.File.FileData)
+		case p.Type == aichat.PartTypeFile && p.File != nil:
+			part = genai.FileData{URI: p.File.FileID}
+		default:
+			return nil, fmt.Errorf("unsupported content part type %q", p.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, part)
+	}
+	return out, nil
+}
+
+// urlToPart converts a data URL to a genai.Blob and any other URL to a genai.FileData
+func urlToPart(url string) (genai.Part, error) {
+	if strings.HasPrefix(url, "data:") {
+		mimeType, data, err := aichat.ParseDataURL(url)
+		if err != nil {
+			return nil, err
+		}
+		return genai.Blob{MIMEType: mimeType, Data: data}, nil
+	}
+	return genai.FileData{MIMEType: mime.TypeByExtension(path.Ext(url)), URI: url}, nil
+}
+
+// partsToContent converts genai parts back to message content.
+// A single text part becomes a string; anything else becomes []*aichat.Part.
+// Blobs and file data are mapped to image, audio, video or file parts by MIME type.
+func partsToContent(parts []genai.Part) (any, error) {
+	if len(parts) == 0 {
+		return "", nil
+	}
+	if t, ok := parts[0].(genai.Text); ok && len(parts) == 1 {
+		return string(t), nil
+	}
+	out := make([]*aichat.Part, 0, len(parts))
+	for _, p := range parts {
+		switch p := p.(type) {
+		case genai.Text:
+			out = append(out, aichat.TextPart(string(p)))
+		case genai.Blob:
+			switch kind, format, _ := strings.Cut(p.MIMEType, "/"); kind {
+			case "image":
+				out = append(out, aichat.ImagePartFromBytes(p.MIMEType, p.Data))
+			case "audio":
+				out = append(out, aichat.AudioPart(format, p.Data))
+			case "video":
+				out = append(out, aichat.VideoPart(aichat.DataURL(p.MIMEType, p.Data)))
+			default:
+				out = append(out, aichat.FilePart("", p.MIMEType, p.Data))
+			}
+		case genai.FileData:
+			switch kind, _, _ := strings.Cut(p.MIMEType, "/"); kind {
+			case "image":
+				out = append(out, aichat.ImagePart(p.URI))
+			case "video":
+				out = append(out, aichat.VideoPart(p.URI))
+			default:
+				out = append(out, aichat.FileIDPart(p.URI))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported genai part %T", p)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package openrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/presbrey/aichat"
+)
+
+// DefaultBaseURL is the OpenRouter API base URL
+const DefaultBaseURL = "https://openrouter.ai/api/v1"
+
+// Client sends chat completion requests to OpenRouter or any OpenAI-compatible API
+type Client struct {
+	// APIKey is sent as a bearer token
+	APIKey string
+	// BaseURL is the API base URL (default DefaultBaseURL)
+	BaseURL string
+	// HTTPClient sends the requests (default http.DefaultClient)
+	HTTPClient *http.Client
+	// Prepare optionally customizes each request built by Complete
+	Prepare func(req *Request)
+}
+
+// Send sends a chat completion request.
+// HTTP and in-body API errors are returned as *aichat.ProviderError.
+func (c *Client) Send(ctx context.Context, req *Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer httpResp.Body.Close()
+	if err := aichat.ErrorFromResponse(httpResp); err != nil {
+		return nil, err
+	}
+
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := resp.Err(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Complete implements aichat.Completer.
+// The response usage and model are recorded in the message meta under aichat.MetaUsage,
+// and the finish reason under aichat.MetaFinishReason.
+func (c *Client) Complete(ctx context.Context, creq *aichat.CompletionRequest) (*aichat.Message, error) {
+	req := &Request{
+		Model:          creq.Model,
+		Messages:       creq.Messages,
+		Tools:          creq.Tools,
+		ResponseFormat: creq.ResponseFormat,
+	}
+	if c.Prepare != nil {
+		c.Prepare(req)
+	}
+	resp, err := c.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return nil, fmt.Errorf("response has no choices")
+	}
+	msg := resp.Choices[0].Message
+	if reason := resp.Choices[0].FinishReason; reason != "" {
+		msg.Meta().Set(aichat.MetaFinishReason, reason)
+	}
+	if usage := resp.MessageUsage(); !usage.IsZero() {
+		if usage.Model == "" {
+			usage.Model = req.Model
+		}
+		msg.SetUsage(usage)
+	}
+	return msg, nil
+}
@@ -0,0 +1,102 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestClientComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var req Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test/model", req.Model)
+		assert.Equal(t, []string{"fallback/model"}, req.Models)
+		require.Len(t, req.Messages, 1)
+		w.Write([]byte(`{"model":"test/model","choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := &Client{
+		APIKey:  "key",
+		BaseURL: server.URL + "/api/v1/",
+		Prepare: func(req *Request) { req.Models = []string{"fallback/model"} },
+	}
+	msg, err := client.Complete(context.Background(), &aichat.CompletionRequest{
+		Model:    "test/model",
+		Messages: []*aichat.Message{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", msg.Content)
+	assert.Equal(t, "stop", msg.Meta().Get(aichat.MetaFinishReason))
+}
+
+func TestClientErrors(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client := &Client{BaseURL: server.URL}
+	req := &aichat.CompletionRequest{Model: "m"}
+
+	status, body = 429, `{"error":{"code":429,"message":"Rate limit exceeded"}}`
+	_, err := client.Complete(context.Background(), req)
+	assert.ErrorIs(t, err, aichat.ErrRateLimited)
+
+	// In-body errors with a 200 status
+	status, body = 200, `{"error":{"code":502,"message":"Provider returned error"}}`
+	_, err = client.Complete(context.Background(), req)
+	assert.ErrorIs(t, err, aichat.ErrServer)
+
+	status, body = 200, `{"choices":[]}`
+	_, err = client.Complete(context.Background(), req)
+	assert.ErrorContains(t, err, "no choices")
+
+	status, body = 200, `not json`
+	_, err = client.Complete(context.Background(), req)
+	assert.ErrorContains(t, err, "failed to decode response")
+
+	server.Close()
+	_, err = client.Complete(context.Background(), req)
+	assert.True(t, aichat.IsRetryable(err))
+}
+
+func TestClientUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"model": "openai/o3-mini",
+			"choices": [{"message": {"role": "assistant", "content": "hi"}}],
+			"usage": {
+				"prompt_tokens": 100, "completion_tokens": 50, "total_tokens": 150, "cost": 0.001,
+				"prompt_tokens_details": {"cached_tokens": 20},
+				"completion_tokens_details": {"reasoning_tokens": 30}
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL}
+	msg, err := client.Complete(context.Background(), &aichat.CompletionRequest{Model: "o3-mini"})
+	require.NoError(t, err)
+	assert.Equal(t, &aichat.Usage{
+		Model:            "openai/o3-mini",
+		PromptTokens:     100,
+		CompletionTokens: 50,
+		CachedTokens:     20,
+		ReasoningTokens:  30,
+		TotalTokens:      150,
+		Cost:             0.001,
+	}, msg.Usage())
+}
@@ -0,0 +1,38 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/presbrey/aichat"
+	"github.com/presbrey/aichat/schema/schematest"
+)
+
+func roundTrip(echoReasoning bool) schematest.RoundTripFunc {
+	return func(chat *aichat.Chat) ([]*aichat.Message, error) {
+		b, err := json.Marshal(&Request{Messages: chat.Messages, EchoReasoning: echoReasoning})
+		if err != nil {
+			return nil, err
+		}
+		req := new(Request)
+		if err := json.Unmarshal(b, req); err != nil {
+			return nil, err
+		}
+		return req.Messages, nil
+	}
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		schematest.Run(t, schematest.Config{
+			RoundTrip: roundTrip(false),
+			// Reasoning is omitted from requests by default
+			Lossy: []schematest.Feature{schematest.FeatureReasoning},
+		})
+	})
+	t.Run("echo reasoning", func(t *testing.T) {
+		schematest.Run(t, schematest.Config{
+			RoundTrip: roundTrip(true),
+		})
+	})
+}
@@ -1,15 +1,17 @@
 package openrouter
 
-import "github.com/presbrey/aichat"
+import (
+	"encoding/json"
+
+	"github.com/presbrey/aichat"
+)
 
 // Request represents a chat completion request to the OpenRouter API
 type Request struct {
-	Messages       []*aichat.Message `json:"messages,omitempty"`
-	Prompt         string            `json:"prompt,omitempty"`
-	Model          string            `json:"model,omitempty"`
-	ResponseFormat *struct {
-		Type string `json:"type"`
-	} `json:"response_format,omitempty"`
+	Messages       []*aichat.Message      `json:"messages,omitempty"`
+	Prompt         string                 `json:"prompt,omitempty"`
+	Model          string                 `json:"model,omitempty"`
+	ResponseFormat *aichat.ResponseFormat `json:"response_format,omitempty"`
 
 	Stop        interface{} `json:"stop,omitempty"` // string or []string
 	Stream      bool        `json:"stream,omitempty"`
@@ -41,13 +43,30 @@ type Request struct {
 	Route      string   `json:"route,omitempty"`
 
 	IncludeReasoning bool `json:"include_reasoning,omitempty"`
+
+	// EchoReasoning includes message reasoning fields in the request,
+	// for models that require thinking signatures to be sent back
+	EchoReasoning bool `json:"-"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r Request) MarshalJSON() ([]byte, error) {
+	type request Request
+	if !r.EchoReasoning {
+		return json.Marshal(request(r))
+	}
+	return json.Marshal(struct {
+		request
+		Messages []*aichat.ReasoningMessage `json:"messages,omitempty"`
+	}{request(r), aichat.WithReasoning(r.Messages)})
 }
 
 // Response represents the API response structure
 type Response struct {
 	Error *struct {
-		Message string `json:"message"`
-		Code    int    `json:"code"`
+		Message  string         `json:"message"`
+		Code     int            `json:"code"`
+		Metadata map[string]any `json:"metadata,omitempty"`
 	} `json:"error,omitempty"`
 
 	UserID   string `json:"user_id,omitempty"`
@@ -68,12 +87,50 @@ type Response struct {
 	} `json:"choices,omitempty"`
 
 	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		TotalTokens         int `json:"total_tokens"`
+		PromptTokensDetails *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details,omitempty"`
+		CompletionTokensDetails *struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details,omitempty"`
+		Cost float64 `json:"cost,omitempty"`
 	} `json:"usage,omitempty"`
 }
 
+// MessageUsage returns the response usage as an aichat.Usage
+func (r *Response) MessageUsage() aichat.Usage {
+	u := aichat.Usage{
+		Model:            r.Model,
+		PromptTokens:     r.Usage.PromptTokens,
+		CompletionTokens: r.Usage.CompletionTokens,
+		TotalTokens:      r.Usage.TotalTokens,
+		Cost:             r.Usage.Cost,
+	}
+	if d := r.Usage.PromptTokensDetails; d != nil {
+		u.CachedTokens = d.CachedTokens
+	}
+	if d := r.Usage.CompletionTokensDetails; d != nil {
+		u.ReasoningTokens = d.ReasoningTokens
+	}
+	return u
+}
+
+// Err returns the response error as an *aichat.ProviderError, or nil.
+// OpenRouter error codes are HTTP status codes.
+func (r *Response) Err() error {
+	if r.Error == nil {
+		return nil
+	}
+	message := r.Error.Message
+	if raw, ok := r.Error.Metadata["raw"].(string); ok && raw != "" {
+		message += ": " + raw
+	}
+	return aichat.NewProviderError(r.Error.Code, "", message)
+}
+
 // ToolChoice represents the model's choice of tool usage
 type ToolChoice struct {
 	Type string `json:"type,omitempty"`
@@ -0,0 +1,74 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestRequestReasoning(t *testing.T) {
+	msg := &aichat.Message{
+		Role:      "assistant",
+		Content:   "4",
+		Reasoning: "2+2=4",
+		ReasoningDetails: []aichat.ReasoningDetail{
+			{Type: "reasoning.text", Text: "2+2=4", Signature: "sig"},
+		},
+	}
+
+	b, err := json.Marshal(&Request{Messages: []*aichat.Message{msg}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"messages":[{"role":"assistant","content":"4"}]}`, string(b))
+
+	b, err = json.Marshal(&Request{Messages: []*aichat.Message{msg}, EchoReasoning: true, Model: "m"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"m","messages":[{"role":"assistant","content":"4","reasoning":"2+2=4","reasoning_details":[{"type":"reasoning.text","text":"2+2=4","signature":"sig"}]}]}`, string(b))
+}
+
+func TestResponseReasoning(t *testing.T) {
+	resp := new(Response)
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "choices": [
+    {"index": 0, "message": {"role": "assistant", "content": "4", "reasoning": "2+2=4",
+      "reasoning_details": [{"type": "reasoning.text", "text": "2+2=4", "signature": "sig", "format": "anthropic-claude-v1"}]}}
+  ]
+}`), resp))
+	msg := resp.Choices[0].Message
+	assert.Equal(t, "4", msg.Content)
+	assert.Equal(t, "2+2=4", msg.Reasoning)
+	assert.Equal(t, []aichat.ReasoningDetail{
+		{Type: "reasoning.text", Text: "2+2=4", Signature: "sig", Format: "anthropic-claude-v1"},
+	}, msg.ReasoningDetails)
+}
+
+func TestRequestResponseFormat(t *testing.T) {
+	type answer struct {
+		Answer string `json:"answer"`
+	}
+	format, err := aichat.NewResponseFormat[answer]("answer")
+	require.NoError(t, err)
+
+	b, err := json.Marshal(&Request{Model: "m", ResponseFormat: format})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"m","response_format":{"type":"json_schema","json_schema":{"name":"answer","strict":true,"schema":{"type":"object","properties":{"answer":{"type":"string"}},"required":["answer"],"additionalProperties":false}}}}`, string(b))
+
+	b, err = json.Marshal(&Request{ResponseFormat: &aichat.ResponseFormat{Type: "json_object"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"response_format":{"type":"json_object"}}`, string(b))
+}
+
+func TestResponseErr(t *testing.T) {
+	var resp Response
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"x"}`), &resp))
+	assert.NoError(t, resp.Err())
+
+	require.NoError(t, json.Unmarshal([]byte(`{"error":{"code":429,"message":"Rate limit exceeded","metadata":{"raw":"upstream busy"}}}`), &resp))
+	err := resp.Err()
+	assert.ErrorIs(t, err, aichat.ErrRateLimited)
+	assert.True(t, aichat.IsRetryable(err))
+	assert.Equal(t, "provider error 429 (rate limited): Rate limit exceeded: upstream busy", err.Error())
+}
@@ -0,0 +1,248 @@
+package schematest
+
+import "github.com/presbrey/aichat"
+
+// Feature identifies a capability exercised by a fixture
+type Feature string
+
+const (
+	// FeatureSystem covers system prompts
+	FeatureSystem Feature = "system"
+	// FeatureMultimodal covers image content parts (data URLs and remote URLs)
+	FeatureMultimodal Feature = "multimodal"
+	// FeatureToolCalls covers assistant tool calls and tool results
+	FeatureToolCalls Feature = "tool_calls"
+	// FeatureParallelToolCalls covers several tool calls in one assistant message
+	FeatureParallelToolCalls Feature = "parallel_tool_calls"
+	// FeatureToolCallIDs covers preservation of tool call IDs
+	FeatureToolCallIDs Feature = "tool_call_ids"
+	// FeatureAudio covers input audio parts
+	FeatureAudio Feature = "audio"
+	// FeatureFiles covers file parts by data URL and by provider file ID
+	FeatureFiles Feature = "files"
+	// FeatureVideo covers video parts
+	FeatureVideo Feature = "video"
+	// FeatureToolResultParts covers tool results carried as content parts
+	FeatureToolResultParts Feature = "tool_result_parts"
+	// FeatureReasoning covers assistant reasoning text and signed reasoning blocks
+	FeatureReasoning Feature = "reasoning"
+)
+
+// Fixture is a canonical chat that every schema converter must round trip
+type Fixture struct {
+	Name     string
+	Features []Feature
+	// Chat builds a fresh copy of the fixture chat
+	Chat func() *aichat.Chat
+}
+
+// Uses reports whether the fixture exercises the given feature
+func (f Fixture) Uses(feature Feature) bool {
+	for _, ff := range f.Features {
+		if ff == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// tinyPNG is a 1x1 transparent PNG encoded as a data URL
+const tinyPNG = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+// Fixtures returns the corpus of canonical chats
+func Fixtures() []Fixture {
+	return []Fixture{
+		{
+			Name:     "text",
+			Features: nil,
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent("Hello!")
+				chat.AddAssistantContent("Hi there, how can I help?")
+				chat.AddUserContent("Tell me a joke.")
+				return chat
+			},
+		},
+		{
+			Name:     "system prompt",
+			Features: []Feature{FeatureSystem},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.SetSystemContent("You are a helpful assistant.")
+				chat.AddUserContent("What is 2+2?")
+				chat.AddAssistantContent("4")
+				return chat
+			},
+		},
+		{
+			Name:     "multimodal",
+			Features: []Feature{FeatureMultimodal},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent([]any{
+					map[string]any{"type": "text", "text": "What is in these images?"},
+					map[string]any{"type": "image_url", "image_url": map[string]any{"url": tinyPNG}},
+					map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/cat.jpg"}},
+				})
+				chat.AddAssistantContent("A transparent pixel and a cat.")
+				return chat
+			},
+		},
+		{
+			Name:     "tool call",
+			Features: []Feature{FeatureToolCalls, FeatureToolCallIDs},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent("What is the weather in Boston?")
+				chat.AddAssistantToolCall([]aichat.ToolCall{{
+					ID:   "call_weather_1",
+					Type: "function",
+					Function: aichat.Function{
+						Name:      "get_weather",
+						Arguments: `{"location":"Boston"}`,
+					},
+				}})
+				chat.AddToolContent("get_weather", "call_weather_1", map[string]any{"temperature": 20, "condition": "sunny"})
+				chat.AddAssistantContent("It is sunny and 20 degrees in Boston.")
+				return chat
+			},
+		},
+		{
+			Name:     "parallel tool calls",
+			Features: []Feature{FeatureToolCalls, FeatureParallelToolCalls, FeatureToolCallIDs},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent("Compare the weather in Boston and Paris.")
+				chat.AddAssistantToolCall([]aichat.ToolCall{
+					{
+						ID:   "call_boston",
+						Type: "function",
+						Function: aichat.Function{
+							Name:      "get_weather",
+							Arguments: `{"location":"Boston"}`,
+						},
+					},
+					{
+						ID:   "call_paris",
+						Type: "function",
+						Function: aichat.Function{
+							Name:      "get_weather",
+							Arguments: `{"location":"Paris","units":"celsius"}`,
+						},
+					},
+				})
+				chat.AddToolContent("get_weather", "call_boston", map[string]any{"temperature": 20})
+				chat.AddToolContent("get_weather", "call_paris", map[string]any{"temperature": 25})
+				chat.AddAssistantContent("Paris is 5 degrees warmer.")
+				return chat
+			},
+		},
+		{
+			Name:     "tool error",
+			Features: []Feature{FeatureToolCalls, FeatureToolCallIDs},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent("What is the weather on Mars?")
+				chat.AddAssistantToolCall([]aichat.ToolCall{{
+					ID:   "call_mars",
+					Type: "function",
+					Function: aichat.Function{
+						Name:      "get_weather",
+						Arguments: `{"location":"Mars"}`,
+					},
+				}})
+				chat.AddToolContent("get_weather", "call_mars", map[string]any{"error": "location not found"})
+				chat.AddAssistantContent("Sorry, I could not find weather for Mars.")
+				return chat
+			},
+		},
+		{
+			Name:     "tool text result",
+			Features: []Feature{FeatureSystem, FeatureToolCalls, FeatureToolCallIDs},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.SetSystemContent("Use tools when needed.")
+				chat.AddUserContent("What time is it?")
+				m := chat.AddAssistantToolCall([]aichat.ToolCall{{
+					ID:   "call_time",
+					Type: "function",
+					Function: aichat.Function{
+						Name: "get_time",
+					},
+				}})
+				m.Content = "Let me check."
+				chat.AddToolContent("get_time", "call_time", "12:00")
+				chat.AddAssistantContent("It is noon.")
+				return chat
+			},
+		},
+		{
+			Name:     "audio and documents",
+			Features: []Feature{FeatureAudio, FeatureFiles},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				msg := chat.AddUserContent(nil)
+				msg.SetContentParts(
+					aichat.TextPart("Summarize the recording and the report."),
+					aichat.AudioPart("wav", []byte("RIFF....WAVEfmt ")),
+					aichat.FilePart("report.pdf", "application/pdf", []byte("%PDF-1.4")),
+				)
+				chat.AddAssistantContent("Both discuss quarterly results.")
+				return chat
+			},
+		},
+		{
+			Name:     "file id",
+			Features: []Feature{FeatureFiles},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				msg := chat.AddUserContent(nil)
+				msg.SetContentParts(aichat.TextPart("What does this file say?"), aichat.FileIDPart("file-abc123"))
+				return chat
+			},
+		},
+		{
+			Name:     "video",
+			Features: []Feature{FeatureVideo},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				msg := chat.AddUserContent(nil)
+				msg.SetContentParts(aichat.TextPart("Describe this clip."), aichat.VideoPart("data:video/mp4;base64,AAAAIGZ0eXBpc29t"))
+				return chat
+			},
+		},
+		{
+			Name:     "tool result parts",
+			Features: []Feature{FeatureToolCalls, FeatureToolResultParts},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent("Look up order 42.")
+				chat.AddAssistantToolCall([]aichat.ToolCall{{
+					ID:       "call_order",
+					Type:     "function",
+					Function: aichat.Function{Name: "get_order", Arguments: `{"id":42}`},
+				}})
+				msg := chat.AddUserContent(nil)
+				msg.SetContentParts(aichat.ToolResultPart("call_order", `{"status":"shipped"}`))
+				return chat
+			},
+		},
+		{
+			Name:     "reasoning",
+			Features: []Feature{FeatureReasoning},
+			Chat: func() *aichat.Chat {
+				chat := new(aichat.Chat)
+				chat.AddUserContent("Is 91 prime?")
+				m := chat.AddAssistantContent("No, 91 = 7 x 13.")
+				m.Reasoning = "91 is odd; try 7: 7 x 13 = 91."
+				m.ReasoningDetails = []aichat.ReasoningDetail{{
+					Type:      "reasoning.text",
+					Format:    "anthropic-claude-v1",
+					Text:      "91 is odd; try 7: 7 x 13 = 91.",
+					Signature: "c2lnbmF0dXJl",
+				}}
+				return chat
+			},
+		},
+	}
+}
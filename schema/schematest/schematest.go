@@ -0,0 +1,221 @@
+// Package schematest provides a conformance suite for schema converters.
+// Every converter that translates an aichat.Chat to a provider wire format
+// should round trip the canonical Fixtures and preserve their meaning.
+package schematest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/presbrey/aichat"
+)
+
+// RoundTripFunc converts a chat to a provider wire format and back to messages
+type RoundTripFunc func(chat *aichat.Chat) ([]*aichat.Message, error)
+
+// Config configures a conformance run
+type Config struct {
+	// RoundTrip converts a chat to the wire format and back
+	RoundTrip RoundTripFunc
+	// Unsupported lists features the converter cannot represent;
+	// fixtures that use them are skipped
+	Unsupported []Feature
+	// Lossy lists features the converter represents only partially;
+	// fields belonging to them are not compared
+	Lossy []Feature
+}
+
+func (cfg Config) has(list []Feature, feature Feature) bool {
+	for _, f := range list {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Run round trips every fixture through cfg.RoundTrip and asserts semantic equivalence
+func Run(t *testing.T, cfg Config) {
+	t.Helper()
+	for _, fixture := range Fixtures() {
+		t.Run(fixture.Name, func(t *testing.T) {
+			for _, feature := range cfg.Unsupported {
+				if fixture.Uses(feature) {
+					t.Skipf("converter does not support %s", feature)
+				}
+			}
+			want := fixture.Chat()
+			got, err := cfg.RoundTrip(fixture.Chat())
+			if !assert.NoError(t, err, "round trip failed") {
+				return
+			}
+			AssertEquivalent(t, want.Messages, got, cfg.Lossy...)
+		})
+	}
+}
+
+// AssertEquivalent asserts that two message lists carry the same meaning,
+// ignoring representation differences such as string versus text-part content.
+// Fields belonging to the ignored features are not compared.
+func AssertEquivalent(t assert.TestingT, want, got []*aichat.Message, ignore ...Feature) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	cfg := Config{Lossy: ignore}
+	return assert.Equal(t, cfg.normalize(want), cfg.normalize(got), "messages are not equivalent")
+}
+
+type normalPart struct {
+	Type       string
+	Text       string
+	URL        string
+	Format     string
+	ToolCallID string
+	Data       any
+}
+
+type normalToolCall struct {
+	ID        string
+	Name      string
+	Arguments any
+}
+
+type normalMessage struct {
+	Role             string
+	Name             string
+	ToolCallID       string
+	Parts            []normalPart
+	ToolCalls        []normalToolCall
+	Reasoning        string
+	ReasoningDetails []aichat.ReasoningDetail
+}
+
+func (cfg Config) normalize(messages []*aichat.Message) []normalMessage {
+	ignoreIDs := cfg.has(cfg.Lossy, FeatureToolCallIDs)
+	ignoreReasoning := cfg.has(cfg.Lossy, FeatureReasoning)
+	out := make([]normalMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		n := normalMessage{
+			Role:       msg.Role,
+			ToolCallID: msg.ToolCallID,
+			Parts:      normalizeContent(msg.Content),
+		}
+		if msg.Role == "tool" {
+			n.Name = msg.Name
+			for i, p := range n.Parts {
+				n.Parts[i] = normalizeJSONText(p)
+			}
+		}
+		if ignoreIDs {
+			n.ToolCallID = ""
+		}
+		if !ignoreReasoning {
+			n.Reasoning = msg.Reasoning
+			if len(msg.ReasoningDetails) > 0 {
+				n.ReasoningDetails = msg.ReasoningDetails
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			nc := normalToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: decodeJSON(call.Function.Arguments, map[string]any{}),
+			}
+			if ignoreIDs {
+				nc.ID = ""
+			}
+			n.ToolCalls = append(n.ToolCalls, nc)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// normalizeContent converts any supported content representation into parts.
+// URLs, data URLs and file IDs are compared; filenames and image detail are not.
+func normalizeContent(content any) []normalPart {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return []normalPart{{Type: "invalid", Text: err.Error()}}
+	}
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		if s == "" {
+			return nil
+		}
+		return []normalPart{{Type: "text", Text: s}}
+	}
+	var raw []map[string]any
+	if json.Unmarshal(b, &raw) != nil {
+		return nil
+	}
+	var parts []normalPart
+	for _, r := range raw {
+		p := normalPart{}
+		p.Type, _ = r["type"].(string)
+		switch p.Type {
+		case "text":
+			p.Text, _ = r["text"].(string)
+			if p.Text == "" {
+				continue
+			}
+		case aichat.PartTypeImageURL, aichat.PartTypeVideoURL:
+			if v, ok := r[p.Type].(map[string]any); ok {
+				p.URL, _ = v["url"].(string)
+			}
+		case aichat.PartTypeInputAudio:
+			if v, ok := r[p.Type].(map[string]any); ok {
+				p.URL, _ = v["data"].(string)
+				p.Format, _ = v["format"].(string)
+			}
+		case aichat.PartTypeFile:
+			if v, ok := r[p.Type].(map[string]any); ok {
+				p.URL, _ = v["file_data"].(string)
+				if p.URL == "" {
+					p.URL, _ = v["file_id"].(string)
+				}
+			}
+		case aichat.PartTypeToolResult:
+			if v, ok := r[p.Type].(map[string]any); ok {
+				p.ToolCallID, _ = v["tool_call_id"].(string)
+				results := normalizeContent(v["content"])
+				for i := range results {
+					results[i] = normalizeJSONText(results[i])
+				}
+				p.Data = results
+			}
+		default:
+			p.Data = r
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// normalizeJSONText decodes JSON tool results so that formatting differences are ignored
+func normalizeJSONText(p normalPart) normalPart {
+	if p.Type != aichat.PartTypeText {
+		return p
+	}
+	var v any
+	if json.Unmarshal([]byte(p.Text), &v) == nil {
+		return normalPart{Type: "json", Data: v}
+	}
+	return p
+}
+
+func decodeJSON(s string, empty any) any {
+	if s == "" {
+		return empty
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
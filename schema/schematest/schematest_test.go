@@ -0,0 +1,53 @@
+package schematest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestRunIdentity(t *testing.T) {
+	Run(t, Config{
+		RoundTrip: func(chat *aichat.Chat) ([]*aichat.Message, error) {
+			return chat.Messages, nil
+		},
+	})
+}
+
+func TestAssertEquivalent(t *testing.T) {
+	want := []*aichat.Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", ToolCalls: []aichat.ToolCall{{ID: "a", Function: aichat.Function{Name: "f", Arguments: `{"x":1}`}}}},
+		{Role: "tool", Name: "f", ToolCallID: "a", Content: `{"ok":true}`},
+	}
+
+	t.Run("representation differences are ignored", func(t *testing.T) {
+		got := []*aichat.Message{
+			{Role: "user", Content: []any{map[string]any{"type": "text", "text": "Hello"}}},
+			{Role: "assistant", Content: "", ToolCalls: []aichat.ToolCall{{ID: "a", Function: aichat.Function{Name: "f", Arguments: `{ "x": 1 }`}}}},
+			{Role: "tool", Name: "f", ToolCallID: "a", Content: `{"ok": true}`},
+		}
+		assert.True(t, AssertEquivalent(t, want, got))
+	})
+
+	t.Run("lossy tool call IDs", func(t *testing.T) {
+		got := []*aichat.Message{
+			{Role: "user", Content: "Hello"},
+			{Role: "assistant", ToolCalls: []aichat.ToolCall{{ID: "call_1", Function: aichat.Function{Name: "f", Arguments: `{"x":1}`}}}},
+			{Role: "tool", Name: "f", ToolCallID: "call_1", Content: `{"ok":true}`},
+		}
+		assert.False(t, AssertEquivalent(new(testing.T), want, got))
+		assert.True(t, AssertEquivalent(t, want, got, FeatureToolCallIDs))
+	})
+
+	t.Run("semantic differences are reported", func(t *testing.T) {
+		got := []*aichat.Message{
+			{Role: "user", Content: "Hello"},
+			{Role: "assistant", ToolCalls: []aichat.ToolCall{{ID: "a", Function: aichat.Function{Name: "f", Arguments: `{"x":2}`}}}},
+			{Role: "tool", Name: "f", ToolCallID: "a", Content: `{"ok":true}`},
+		}
+		assert.False(t, AssertEquivalent(new(testing.T), want, got))
+	})
+}
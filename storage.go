@@ -19,24 +19,33 @@ type S3 interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// s3message embeds ReasoningMessage so that reasoning fields are persisted
 type s3message struct {
-	*Message
-	Meta map[string]any `json:"meta,omitempty"`
+	*ReasoningMessage
+	Meta     map[string]any `json:"meta,omitempty"`
+	ID       string         `json:"id,omitempty"`
+	ParentID string         `json:"parent_id,omitempty"`
+	Created  *time.Time     `json:"created,omitempty"`
 }
 
 type s3chat struct {
 	ID          string         `json:"id,omitempty"`
 	Messages    []*s3message   `json:"messages"`
+	Branches    []*s3message   `json:"branches,omitempty"`
 	Meta        map[string]any `json:"meta,omitempty"`
 	Created     time.Time      `json:"created"`
 	LastUpdated time.Time      `json:"last_updated"`
 }
 
 // Load loads a chat from S3 storage
-func (chat *Chat) Load(ctx context.Context, key string) error {
+func (chat *Chat) Load(ctx context.Context, key string) (err error) {
 	if chat.Options.S3 == nil {
 		return fmt.Errorf("s3 storage not initialized")
 	}
+	if l := chat.Options.Logging; l != nil {
+		start := time.Now()
+		defer func() { l.logStorage(ctx, "load", key, chat, start, err) }()
+	}
 
 	reader, err := chat.Options.S3.Get(ctx, key)
 	if err != nil {
@@ -57,44 +66,87 @@ func (chat *Chat) Load(ctx context.Context, key string) error {
 	chat.Meta = s3payload.Meta
 
 	// Reconstruct messages and restore metadata
-	loadedMessages := make([]*Message, 0, len(s3payload.Messages))
-	for _, s3msg := range s3payload.Messages {
+	chat.Messages = fromS3Messages(s3payload.Messages)
+
+	// Restore the conversation tree with its inactive branches
+	chat.tree, chat.inTree = nil, nil
+	if len(s3payload.Branches) > 0 {
+		chat.tree = append(append([]*Message{}, chat.Messages...), fromS3Messages(s3payload.Branches)...)
+	}
+
+	return nil
+}
+
+// toS3Messages converts messages to s3message format, including metadata
+func toS3Messages(messages []*Message) []*s3message {
+	s3messages := make([]*s3message, 0, len(messages))
+	for _, msg := range messages {
+		s3msg := &s3message{
+			ReasoningMessage: (*ReasoningMessage)(msg),
+			Meta:             msg.meta,
+			ID:               msg.ID,
+			ParentID:         msg.ParentID,
+		}
+		if !msg.Created.IsZero() {
+			s3msg.Created = &msg.Created
+		}
+		s3messages = append(s3messages, s3msg)
+	}
+	return s3messages
+}
+
+// fromS3Messages reconstructs messages from s3message format and restores their metadata
+func fromS3Messages(s3messages []*s3message) []*Message {
+	messages := make([]*Message, 0, len(s3messages))
+	for _, s3msg := range s3messages {
 		// Start with the base message decoded within s3message
-		msg := s3msg.Message
+		msg := (*Message)(s3msg.ReasoningMessage)
 		if msg == nil {
 			// Handle cases where the embedded message might be nil, though unlikely if saved correctly
 			continue
 		}
 
-		// Restore metadata from s3msg.Meta
+		// Restore metadata and tree links
 		msg.meta = s3msg.Meta
-		loadedMessages = append(loadedMessages, msg)
+		msg.ID = s3msg.ID
+		msg.ParentID = s3msg.ParentID
+		if s3msg.Created != nil {
+			msg.Created = *s3msg.Created
+		}
+		messages = append(messages, msg)
 	}
-	chat.Messages = loadedMessages // Assign the reconstructed messages
-
-	return nil
+	return messages
 }
 
 // Save saves the session to S3 storage
-func (chat *Chat) Save(ctx context.Context, key string) error {
+func (chat *Chat) Save(ctx context.Context, key string) (err error) {
 	// Ensure S3 storage is configured in options.
 	// We assume Options struct itself is not a pointer based on previous lint error.
 	if chat.Options.S3 == nil {
 		return fmt.Errorf("s3 storage not initialized in options")
 	}
+	if l := chat.Options.Logging; l != nil {
+		start := time.Now()
+		defer func() { l.logStorage(ctx, "save", key, chat, start, err) }()
+	}
 
-	// Convert Messages to s3message format, including metadata
-	s3messages := make([]*s3message, 0, len(chat.Messages))
-	for _, msg := range chat.Messages {
-		s3msg := &s3message{Message: msg, Meta: msg.meta}
-		s3messages = append(s3messages, s3msg)
+	// Move inline binary content to the attachment store, keeping it in memory
+	messages, branches := chat.Messages, chat.inactiveMessages()
+	if store := chat.Options.Attachments; store != nil {
+		if messages, err = store.Externalize(ctx, messages); err != nil {
+			return fmt.Errorf("failed to store attachments: %w", err)
+		}
+		if branches, err = store.Externalize(ctx, branches); err != nil {
+			return fmt.Errorf("failed to store attachments: %w", err)
+		}
 	}
 
 	// Prepare the payload including explicitly chosen chat fields and converted messages
 	s3payload := s3chat{
 		ID:          chat.ID,
 		Meta:        chat.Meta,
-		Messages:    s3messages,
+		Messages:    toS3Messages(messages),
+		Branches:    toS3Messages(branches),
 		Created:     chat.Created,
 		LastUpdated: chat.LastUpdated,
 	}
@@ -103,6 +103,26 @@ func TestChatStorage(t *testing.T) {
 	assert.NoError(t, err, "Failed to delete session")
 }
 
+func TestStorageReasoning(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	chat := &aichat.Chat{ID: "reasoning-id", Options: aichat.Options{S3: s3}}
+
+	chat.AddUserContent("Is 91 prime?")
+	msg := chat.AddAssistantContent("No")
+	msg.Reasoning = "7 x 13 = 91"
+	msg.ReasoningDetails = []aichat.ReasoningDetail{{Type: "reasoning.text", Text: "7 x 13 = 91", Signature: "sig"}}
+	msg.Meta().Set("model", "test")
+	assert.NoError(t, chat.Save(ctx, "reasoning-key"))
+
+	loaded := &aichat.Chat{Options: aichat.Options{S3: s3}}
+	assert.NoError(t, loaded.Load(ctx, "reasoning-key"))
+	assert.Len(t, loaded.Messages, 2)
+	assert.Equal(t, "7 x 13 = 91", loaded.Messages[1].Reasoning)
+	assert.Equal(t, msg.ReasoningDetails, loaded.Messages[1].ReasoningDetails)
+	assert.Equal(t, "test", loaded.Messages[1].Meta().Get("model"))
+}
+
 func TestStorageErrors(t *testing.T) {
 	ctx := context.Background()
 
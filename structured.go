@@ -0,0 +1,470 @@
+package aichat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema subset describing structured model output
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	// Nullable allows null besides values of Type; it is marshaled as a [Type, "null"] type array
+	Nullable bool `json:"-"`
+}
+
+// MarshalJSON encodes nullable types as a type array
+func (s Schema) MarshalJSON() ([]byte, error) {
+	type schema Schema
+	if !s.Nullable || s.Type == "" {
+		return json.Marshal(schema(s))
+	}
+	return json.Marshal(struct {
+		Type []string `json:"type"`
+		schema
+	}{[]string{s.Type, "null"}, schema(s)})
+}
+
+// UnmarshalJSON decodes a type given as a string or as a type array with "null"
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	type schema Schema
+	v := struct {
+		Type json.RawMessage `json:"type"`
+		*schema
+	}{schema: (*schema)(s)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	s.Type, s.Nullable = "", false
+	if len(v.Type) == 0 || string(v.Type) == "null" {
+		return nil
+	}
+	if v.Type[0] == '"' {
+		return json.Unmarshal(v.Type, &s.Type)
+	}
+	var types []string
+	if err := json.Unmarshal(v.Type, &types); err != nil {
+		return err
+	}
+	for _, t := range types {
+		switch {
+		case t == "null":
+			s.Nullable = true
+		case s.Type == "":
+			s.Type = t
+		default:
+			return fmt.Errorf("unsupported schema type %v", types)
+		}
+	}
+	if s.Type == "" {
+		s.Type, s.Nullable = "null", false
+	}
+	return nil
+}
+
+// ResponseFormat requests a response format from the model
+type ResponseFormat struct {
+	// Type is "text", "json_object" or "json_schema"
+	Type       string          `json:"type"`
+	JSONSchema *JSONSchemaSpec `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaSpec names the schema of a json_schema response format
+type JSONSchemaSpec struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+	Strict      bool    `json:"strict,omitempty"`
+}
+
+// NewResponseFormat returns a json_schema response format for the type T.
+// Strict mode is enabled when the schema allows it, i.e. every property is required.
+func NewResponseFormat[T any](name string) (*ResponseFormat, error) {
+	schema, err := SchemaFor[T]()
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &JSONSchemaSpec{
+			Name:   name,
+			Schema: schema,
+			Strict: schema.strictCompatible(),
+		},
+	}, nil
+}
+
+// SchemaFor generates the JSON schema of the type T.
+// Struct fields follow encoding/json naming; fields without omitempty are required,
+// and required pointer fields are nullable.
+// The description and enum (comma separated) struct tags annotate fields.
+func SchemaFor[T any]() (*Schema, error) {
+	return GenerateSchema(reflect.TypeFor[T]())
+}
+
+// GenerateSchema generates the JSON schema of a Go type
+func GenerateSchema(t reflect.Type) (*Schema, error) {
+	return generateSchema(t, make(map[reflect.Type]bool))
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+func generateSchema(t reflect.Type, seen map[reflect.Type]bool) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case t == rawMessageType:
+		return &Schema{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		// encoding/json encodes byte slices, but not byte arrays, as base64 strings
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := generateSchema(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		return &Schema{Type: "object"}, nil
+	case reflect.Struct:
+		if seen[t] {
+			return nil, fmt.Errorf("recursive type %s is not supported", t)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		schema := &Schema{
+			Type:                 "object",
+			Properties:           make(map[string]*Schema),
+			AdditionalProperties: new(bool),
+		}
+		if err := addStructFields(schema, t, seen); err != nil {
+			return nil, err
+		}
+		return schema, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// addStructFields adds the JSON fields of a struct type, flattening embedded structs
+func addStructFields(schema *Schema, t reflect.Type, seen map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if seen[ft] {
+					return fmt.Errorf("recursive type %s is not supported", ft)
+				}
+				seen[ft] = true
+				err := addStructFields(schema, ft, seen)
+				delete(seen, ft)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := generateSchema(field.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		prop.Description = field.Tag.Get("description")
+		if enum := field.Tag.Get("enum"); enum != "" {
+			for _, v := range strings.Split(enum, ",") {
+				prop.Enum = append(prop.Enum, v)
+			}
+		}
+		schema.Properties[name] = prop
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+			// A nil pointer is encoded as null
+			prop.Nullable = field.Type.Kind() == reflect.Pointer
+		}
+	}
+	return nil
+}
+
+// strictCompatible reports whether every object property in the schema is required
+// and no object allows additional properties, as strict structured output demands
+func (s *Schema) strictCompatible() bool {
+	if s == nil {
+		return true
+	}
+	if s.Type == "object" {
+		if s.AdditionalProperties == nil || *s.AdditionalProperties || len(s.Required) != len(s.Properties) {
+			return false
+		}
+	}
+	for _, prop := range s.Properties {
+		if !prop.strictCompatible() {
+			return false
+		}
+	}
+	return s.Items.strictCompatible()
+}
+
+// Validate validates a decoded JSON value (as produced by json.Unmarshal into any) against the schema
+func (s *Schema) Validate(v any) error {
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v any) error {
+	if s == nil {
+		return nil
+	}
+	if v == nil && s.Nullable {
+		return nil
+	}
+	if len(s.Enum) > 0 && !enumContains(s.Enum, v) {
+		return fmt.Errorf("%s: value %v is not one of %v", path, v, s.Enum)
+	}
+	switch s.Type {
+	case "":
+		return nil
+	case "null":
+		if v != nil {
+			return fmt.Errorf("%s: expected null", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, value := range obj {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := prop.validate(path+"."+name, value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, s.Type)
+	}
+	return nil
+}
+
+// enumContains compares values by their JSON encoding
+func enumContains(enum []any, v any) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	for _, e := range enum {
+		if eb, err := json.Marshal(e); err == nil && bytes.Equal(eb, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepairJSON extracts a JSON value from model output, removing code fences,
+// surrounding prose and trailing commas
+func RepairJSON(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if json.Valid([]byte(text)) {
+		return text, nil
+	}
+	if _, fenced, ok := strings.Cut(text, "```"); ok {
+		// skip the language tag, e.g. ```json
+		if nl := strings.IndexByte(fenced, '\n'); nl >= 0 {
+			fenced = fenced[nl+1:]
+		}
+		fenced, _, _ = strings.Cut(fenced, "```")
+		text = strings.TrimSpace(fenced)
+	}
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return "", fmt.Errorf("no JSON value found")
+	}
+	text = removeTrailingCommas(scanJSONValue(text[start:]))
+	if !json.Valid([]byte(text)) {
+		return "", fmt.Errorf("invalid JSON value")
+	}
+	return text, nil
+}
+
+// scanJSONValue returns the prefix of text up to the bracket closing its first bracket
+func scanJSONValue(text string) string {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth == 0 {
+				return text[:i+1]
+			}
+		}
+	}
+	return text
+}
+
+// removeTrailingCommas removes commas directly before a closing bracket, outside strings
+func removeTrailingCommas(text string) string {
+	var b strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			rest := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if rest != "" && (rest[0] == '}' || rest[0] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// ParseStructured extracts the JSON output of a message, validates it against
+// the schema of T and decodes it into T
+func ParseStructured[T any](msg *Message) (T, error) {
+	var result T
+	if msg == nil {
+		return result, fmt.Errorf("message is nil")
+	}
+	text := msg.ContentString()
+	if text == "" {
+		parts, err := msg.ContentParts()
+		if err != nil {
+			return result, fmt.Errorf("failed to read content parts: %w", err)
+		}
+		for _, p := range parts {
+			if p.Type == PartTypeText {
+				text += p.Text
+			}
+		}
+	}
+
+	data, err := RepairJSON(text)
+	if err != nil {
+		return result, fmt.Errorf("failed to extract JSON: %w", err)
+	}
+	schema, err := SchemaFor[T]()
+	if err != nil {
+		return result, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return result, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if err := schema.Validate(value); err != nil {
+		return result, fmt.Errorf("failed to validate JSON: %w", err)
+	}
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return result, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package aichat_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+type weatherReport struct {
+	City        string    `json:"city" description:"City name"`
+	Unit        string    `json:"unit" enum:"celsius,fahrenheit"`
+	Temperature float64   `json:"temperature"`
+	Days        []int     `json:"days"`
+	Observed    time.Time `json:"observed"`
+	Note        string    `json:"note,omitempty"`
+	Internal    string    `json:"-"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema, err := aichat.SchemaFor[weatherReport]()
+	require.NoError(t, err)
+	b, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "description": "City name"},
+			"unit": {"type": "string", "enum": ["celsius", "fahrenheit"]},
+			"temperature": {"type": "number"},
+			"days": {"type": "array", "items": {"type": "integer"}},
+			"observed": {"type": "string", "format": "date-time"},
+			"note": {"type": "string"}
+		},
+		"required": ["city", "unit", "temperature", "days", "observed"],
+		"additionalProperties": false
+	}`, string(b))
+
+	_, err = aichat.SchemaFor[map[int]string]()
+	assert.Error(t, err)
+	_, err = aichat.SchemaFor[chan int]()
+	assert.Error(t, err)
+
+	type node struct {
+		Children []node `json:"children"`
+	}
+	_, err = aichat.SchemaFor[node]()
+	assert.Error(t, err)
+
+	type embedded struct {
+		*embedded
+		Name string `json:"name"`
+	}
+	_, err = aichat.SchemaFor[embedded]()
+	assert.ErrorContains(t, err, "recursive type")
+}
+
+func TestSchemaForBytesAndPointers(t *testing.T) {
+	type payload struct {
+		Data     []byte  `json:"data"`
+		Digest   [4]byte `json:"digest"`
+		Parent   *string `json:"parent"`
+		Optional *int    `json:"optional,omitempty"`
+	}
+	schema, err := aichat.SchemaFor[payload]()
+	require.NoError(t, err)
+	b, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"data": {"type": "string", "format": "byte"},
+			"digest": {"type": "array", "items": {"type": "integer"}},
+			"parent": {"type": ["string", "null"]},
+			"optional": {"type": "integer"}
+		},
+		"required": ["data", "digest", "parent"],
+		"additionalProperties": false
+	}`, string(b))
+
+	// The schema validates what encoding/json produces
+	out, err := json.Marshal(payload{Data: []byte("hi")})
+	require.NoError(t, err)
+	var v any
+	require.NoError(t, json.Unmarshal(out, &v))
+	assert.NoError(t, schema.Validate(v))
+
+	var decoded aichat.Schema
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, schema, &decoded)
+}
+
+func TestNewResponseFormat(t *testing.T) {
+	format, err := aichat.NewResponseFormat[weatherReport]("weather")
+	require.NoError(t, err)
+	assert.Equal(t, "json_schema", format.Type)
+	assert.Equal(t, "weather", format.JSONSchema.Name)
+	assert.False(t, format.JSONSchema.Strict, "optional fields are not allowed in strict mode")
+
+	type answer struct {
+		Answer string `json:"answer"`
+	}
+	format, err = aichat.NewResponseFormat[answer]("answer")
+	require.NoError(t, err)
+	assert.True(t, format.JSONSchema.Strict)
+	b, err := json.Marshal(format)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"json_schema","json_schema":{"name":"answer","strict":true,"schema":{"type":"object","properties":{"answer":{"type":"string"}},"required":["answer"],"additionalProperties":false}}}`, string(b))
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name, input, expected string
+	}{
+		{"valid", `{"a":1}`, `{"a":1}`},
+		{"code fence", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"prose", `Here you go: {"a":"}"} Hope this helps!`, `{"a":"}"}`},
+		{"trailing commas", `{"a":[1,2,],}`, `{"a":[1,2]}`},
+		{"array", `Result: [1, 2]`, `[1, 2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := aichat.RepairJSON(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+
+	_, err := aichat.RepairJSON("no json here")
+	assert.Error(t, err)
+	_, err = aichat.RepairJSON(`{"a": }`)
+	assert.Error(t, err)
+}
+
+func TestParseStructured(t *testing.T) {
+	msg := &aichat.Message{Role: "assistant", Content: "```json\n" + `{
+		"city": "Boston",
+		"unit": "celsius",
+		"temperature": 21.5,
+		"days": [1, 2],
+		"observed": "2025-02-09T12:00:00Z",
+	}` + "\n```"}
+	report, err := aichat.ParseStructured[weatherReport](msg)
+	require.NoError(t, err)
+	assert.Equal(t, "Boston", report.City)
+	assert.Equal(t, 21.5, report.Temperature)
+	assert.Equal(t, []int{1, 2}, report.Days)
+	assert.Equal(t, time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC), report.Observed)
+
+	// Multipart text content
+	msg = &aichat.Message{Role: "assistant"}
+	msg.SetContentParts(aichat.TextPart(`{"answer":`), aichat.TextPart(`"yes"}`))
+	answer, err := aichat.ParseStructured[map[string]string](msg)
+	require.NoError(t, err)
+	assert.Equal(t, "yes", answer["answer"])
+
+	errorTests := []struct {
+		name, content, expected string
+	}{
+		{"additional property", `{"city":"Boston","unit":"celsius","temperature":1,"days":[],"observed":"2025-02-09T12:00:00Z","note":"x","extra":1}`, `unexpected property "extra"`},
+		{"required", `{"city":"Boston"}`, `missing required property "unit"`},
+		{"enum", `{"city":"Boston","unit":"kelvin","temperature":1,"days":[],"observed":"2025-02-09T12:00:00Z"}`, `$.unit: value kelvin is not one of`},
+		{"type", `{"city":"Boston","unit":"celsius","temperature":1,"days":[1.5],"observed":"2025-02-09T12:00:00Z"}`, `$.days[0]: expected integer`},
+		{"not json", `sorry, I cannot help`, `failed to extract JSON`},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := aichat.ParseStructured[weatherReport](&aichat.Message{Content: tt.content})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+
+	_, err = aichat.ParseStructured[weatherReport](nil)
+	assert.Error(t, err)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := &aichat.Schema{Type: "object", Properties: map[string]*aichat.Schema{
+		"ok":   {Type: "boolean"},
+		"none": {Type: "null"},
+		"any":  {},
+	}}
+	assert.NoError(t, schema.Validate(map[string]any{"ok": true, "none": nil, "any": 1.0, "other": "x"}))
+	assert.Error(t, schema.Validate(map[string]any{"ok": "yes"}))
+	assert.Error(t, schema.Validate(map[string]any{"none": 1.0}))
+	assert.Error(t, schema.Validate([]any{}))
+	assert.Error(t, (&aichat.Schema{Type: "number"}).Validate("1"))
+	assert.Error(t, (&aichat.Schema{Type: "array"}).Validate("1"))
+	assert.Error(t, (&aichat.Schema{Type: "tuple"}).Validate("1"))
+}
@@ -0,0 +1,211 @@
+package aichat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MetaFinishReason is the message meta key recording why the model stopped generating
+const MetaFinishReason = "finish_reason"
+
+// instrumentationName names the tracer and meter of the package
+const instrumentationName = "github.com/presbrey/aichat"
+
+// GenAI semantic convention attributes
+const (
+	AttrOperationName         = attribute.Key("gen_ai.operation.name")
+	AttrSystem                = attribute.Key("gen_ai.system")
+	AttrRequestModel          = attribute.Key("gen_ai.request.model")
+	AttrResponseModel         = attribute.Key("gen_ai.response.model")
+	AttrResponseFinishReasons = attribute.Key("gen_ai.response.finish_reasons")
+	AttrUsageInputTokens      = attribute.Key("gen_ai.usage.input_tokens")
+	AttrUsageOutputTokens     = attribute.Key("gen_ai.usage.output_tokens")
+	AttrTokenType             = attribute.Key("gen_ai.token.type")
+	AttrToolName              = attribute.Key("gen_ai.tool.name")
+	AttrToolCallID            = attribute.Key("gen_ai.tool.call.id")
+	AttrToolType              = attribute.Key("gen_ai.tool.type")
+	AttrErrorType             = attribute.Key("error.type")
+)
+
+// GenAI operation names
+const (
+	OperationChat        = "chat"
+	OperationExecuteTool = "execute_tool"
+)
+
+// Telemetry records OpenTelemetry spans and metrics for model requests and tool calls,
+// following the GenAI semantic conventions. Wrap a client with Completer to trace model
+// requests, and set Options.Telemetry to trace tools run by RangePendingToolCalls.
+//
+// Metrics are the gen_ai.client.operation.duration histogram (seconds) for requests and
+// tool calls, the gen_ai.client.token.usage histogram (tokens per request, by token type),
+// and the aichat.client.token.count counter (total tokens, by token type).
+type Telemetry struct {
+	// TracerProvider creates the tracer (default the global tracer provider)
+	TracerProvider trace.TracerProvider
+	// MeterProvider creates the meter (default the global meter provider)
+	MeterProvider metric.MeterProvider
+
+	once       sync.Once
+	tracer     trace.Tracer
+	duration   metric.Float64Histogram
+	tokenUsage metric.Int64Histogram
+	tokenCount metric.Int64Counter
+}
+
+func (t *Telemetry) init() {
+	t.once.Do(func() {
+		tp := t.TracerProvider
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+		mp := t.MeterProvider
+		if mp == nil {
+			mp = otel.GetMeterProvider()
+		}
+		t.tracer = tp.Tracer(instrumentationName)
+		meter := mp.Meter(instrumentationName)
+
+		// Instrument creation only fails for invalid names, and returns a no-op instrument
+		var err error
+		t.duration, err = meter.Float64Histogram("gen_ai.client.operation.duration",
+			metric.WithDescription("GenAI operation duration"),
+			metric.WithUnit("s"))
+		if err != nil {
+			otel.Handle(err)
+		}
+		t.tokenUsage, err = meter.Int64Histogram("gen_ai.client.token.usage",
+			metric.WithDescription("Measures number of input and output tokens used"),
+			metric.WithUnit("{token}"))
+		if err != nil {
+			otel.Handle(err)
+		}
+		t.tokenCount, err = meter.Int64Counter("aichat.client.token.count",
+			metric.WithDescription("Total number of input and output tokens used"),
+			metric.WithUnit("{token}"))
+		if err != nil {
+			otel.Handle(err)
+		}
+	})
+}
+
+// Completer returns a Completer that traces the requests sent to client.
+// The provider is recorded as gen_ai.system.
+func (t *Telemetry) Completer(provider string, client Completer) Completer {
+	return CompleterFunc(func(ctx context.Context, req *CompletionRequest) (*Message, error) {
+		t.init()
+		attrs := []attribute.KeyValue{
+			AttrOperationName.String(OperationChat),
+			AttrSystem.String(provider),
+			AttrRequestModel.String(req.Model),
+		}
+		ctx, span := t.tracer.Start(ctx, OperationChat+" "+req.Model,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...))
+		defer span.End()
+
+		start := time.Now()
+		msg, err := client.Complete(ctx, req)
+		if err != nil {
+			attrs = append(attrs, AttrErrorType.String(errorType(err)))
+			span.SetAttributes(AttrErrorType.String(errorType(err)))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			t.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+			return msg, err
+		}
+
+		var usage *Usage
+		if msg != nil {
+			if reason, ok := msg.Meta().Get(MetaFinishReason).(string); ok && reason != "" {
+				span.SetAttributes(AttrResponseFinishReasons.StringSlice([]string{reason}))
+			}
+			usage = msg.Usage()
+		}
+		if usage != nil && usage.Model != "" {
+			attrs = append(attrs, AttrResponseModel.String(usage.Model))
+			span.SetAttributes(AttrResponseModel.String(usage.Model))
+		}
+		t.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		if usage != nil {
+			span.SetAttributes(
+				AttrUsageInputTokens.Int(usage.PromptTokens),
+				AttrUsageOutputTokens.Int(usage.CompletionTokens),
+			)
+			t.recordTokens(ctx, attrs, "input", usage.PromptTokens)
+			t.recordTokens(ctx, attrs, "output", usage.CompletionTokens)
+		}
+		return msg, nil
+	})
+}
+
+func (t *Telemetry) recordTokens(ctx context.Context, attrs []attribute.KeyValue, tokenType string, n int) {
+	opt := metric.WithAttributes(append(attrs[:len(attrs):len(attrs)], AttrTokenType.String(tokenType))...)
+	t.tokenUsage.Record(ctx, int64(n), opt)
+	t.tokenCount.Add(ctx, int64(n), opt)
+}
+
+// traceTool runs a tool call in an execute_tool span and records its duration
+func (t *Telemetry) traceTool(ctx context.Context, tcc *ToolCallContext, fn func(*ToolCallContext) error) error {
+	t.init()
+	attrs := []attribute.KeyValue{
+		AttrOperationName.String(OperationExecuteTool),
+		AttrToolName.String(tcc.Name()),
+	}
+	ctx, span := t.tracer.Start(ctx, OperationExecuteTool+" "+tcc.Name(),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(
+			AttrToolCallID.String(tcc.ToolCall.ID),
+			AttrToolType.String(tcc.ToolCall.Type),
+		))
+	defer span.End()
+	tcc.ctx = ctx
+
+	start := time.Now()
+	err := fn(tcc)
+	if err != nil {
+		attrs = append(attrs, AttrErrorType.String(errorType(err)))
+		span.SetAttributes(AttrErrorType.String(errorType(err)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	t.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	return err
+}
+
+// errorTypes maps error classes to error.type attribute values
+var errorTypes = []struct {
+	err  error
+	name string
+}{
+	{ErrRateLimited, "rate_limited"},
+	{ErrQuotaExceeded, "quota_exceeded"},
+	{ErrContextLengthExceeded, "context_length_exceeded"},
+	{ErrContentFiltered, "content_filtered"},
+	{ErrAuth, "auth"},
+	{ErrServer, "server_error"},
+	{ErrBadRequest, "bad_request"},
+	{context.Canceled, "canceled"},
+	{context.DeadlineExceeded, "timeout"},
+}
+
+// errorType returns the error.type attribute value: the error class,
+// or the Go type of other errors
+func errorType(err error) string {
+	for _, et := range errorTypes {
+		if errors.Is(err, et.err) {
+			return et.name
+		}
+	}
+	return fmt.Sprintf("%T", err)
+}
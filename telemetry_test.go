@@ -0,0 +1,187 @@
+package aichat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/presbrey/aichat"
+)
+
+func newTestTelemetry() (*aichat.Telemetry, *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	exporter := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	return &aichat.Telemetry{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	}, exporter, reader
+}
+
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestTelemetryCompleter(t *testing.T) {
+	telemetry, exporter, reader := newTestTelemetry()
+	client := telemetry.Completer("openrouter", aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		assert.True(t, trace.SpanContextFromContext(ctx).IsValid(), "client runs inside the span")
+		msg := &aichat.Message{Role: "assistant", Content: "hi"}
+		msg.SetUsage(aichat.Usage{Model: "openai/gpt-4o-2024-11-20", PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15})
+		msg.Meta().Set(aichat.MetaFinishReason, "stop")
+		return msg, nil
+	}))
+
+	chat := &aichat.Chat{}
+	chat.AddUserContent("hello")
+	_, err := client.Complete(context.Background(), chat.CompletionRequest("openai/gpt-4o"))
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "chat openai/gpt-4o", spans[0].Name)
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+	attrs := spanAttrs(spans[0])
+	assert.Equal(t, "chat", attrs[aichat.AttrOperationName].AsString())
+	assert.Equal(t, "openrouter", attrs[aichat.AttrSystem].AsString())
+	assert.Equal(t, "openai/gpt-4o", attrs[aichat.AttrRequestModel].AsString())
+	assert.Equal(t, "openai/gpt-4o-2024-11-20", attrs[aichat.AttrResponseModel].AsString())
+	assert.Equal(t, []string{"stop"}, attrs[aichat.AttrResponseFinishReasons].AsStringSlice())
+	assert.Equal(t, int64(12), attrs[aichat.AttrUsageInputTokens].AsInt64())
+	assert.Equal(t, int64(3), attrs[aichat.AttrUsageOutputTokens].AsInt64())
+
+	metrics := collectMetrics(t, reader)
+	duration, ok := metrics["gen_ai.client.operation.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, duration.DataPoints, 1)
+	assert.Equal(t, uint64(1), duration.DataPoints[0].Count)
+
+	usage, ok := metrics["gen_ai.client.token.usage"].Data.(metricdata.Histogram[int64])
+	require.True(t, ok)
+	sums := make(map[string]int64)
+	for _, dp := range usage.DataPoints {
+		tokenType, _ := dp.Attributes.Value(aichat.AttrTokenType)
+		sums[tokenType.AsString()] = dp.Sum
+	}
+	assert.Equal(t, map[string]int64{"input": 12, "output": 3}, sums)
+
+	count, ok := metrics["aichat.client.token.count"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	var total int64
+	for _, dp := range count.DataPoints {
+		total += dp.Value
+	}
+	assert.Equal(t, int64(15), total)
+}
+
+func TestTelemetryCompleterError(t *testing.T) {
+	telemetry, exporter, _ := newTestTelemetry()
+	client := telemetry.Completer("openrouter", aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return nil, aichat.NewProviderError(429, "", "slow down")
+	}))
+
+	_, err := client.Complete(context.Background(), &aichat.CompletionRequest{Model: "m"})
+	require.ErrorIs(t, err, aichat.ErrRateLimited)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "rate_limited", spanAttrs(spans[0])[aichat.AttrErrorType].AsString())
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "exception", spans[0].Events[0].Name)
+}
+
+func TestTelemetryCompleterNoMessage(t *testing.T) {
+	telemetry, exporter, _ := newTestTelemetry()
+	client := telemetry.Completer("openrouter", aichat.CompleterFunc(func(ctx context.Context, req *aichat.CompletionRequest) (*aichat.Message, error) {
+		return nil, nil
+	}))
+
+	msg, err := client.Complete(context.Background(), &aichat.CompletionRequest{Model: "m"})
+	assert.NoError(t, err)
+	assert.Nil(t, msg)
+	assert.Len(t, exporter.GetSpans(), 1)
+}
+
+func TestTelemetryToolCalls(t *testing.T) {
+	telemetry, exporter, reader := newTestTelemetry()
+	chat := &aichat.Chat{Options: aichat.Options{Telemetry: telemetry}}
+	chat.AddUserContent("weather?")
+	chat.AddAssistantToolCall([]aichat.ToolCall{
+		{ID: "call_1", Type: "function", Function: aichat.Function{Name: "get_weather", Arguments: "{}"}},
+		{ID: "call_2", Type: "function", Function: aichat.Function{Name: "get_time", Arguments: "{}"}},
+	})
+
+	parent, root := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "agent")
+	defer root.End()
+
+	errBroken := errors.New("broken")
+	err := chat.RangePendingToolCallsContext(parent, func(tc *aichat.ToolCallContext) error {
+		assert.True(t, trace.SpanContextFromContext(tc.Context()).IsValid())
+		if tc.Name() == "get_time" {
+			return errBroken
+		}
+		return tc.Return(map[string]any{"condition": "sunny"})
+	})
+	require.ErrorIs(t, err, errBroken)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "execute_tool get_weather", spans[0].Name)
+	assert.Equal(t, root.SpanContext().TraceID(), spans[0].SpanContext.TraceID())
+	assert.Equal(t, root.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	attrs := spanAttrs(spans[0])
+	assert.Equal(t, "execute_tool", attrs[aichat.AttrOperationName].AsString())
+	assert.Equal(t, "get_weather", attrs[aichat.AttrToolName].AsString())
+	assert.Equal(t, "call_1", attrs[aichat.AttrToolCallID].AsString())
+	assert.Equal(t, "function", attrs[aichat.AttrToolType].AsString())
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+
+	assert.Equal(t, "execute_tool get_time", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "*errors.errorString", spanAttrs(spans[1])[aichat.AttrErrorType].AsString())
+
+	duration, ok := collectMetrics(t, reader)["gen_ai.client.operation.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	var calls uint64
+	for _, dp := range duration.DataPoints {
+		calls += dp.Count
+	}
+	assert.Equal(t, uint64(2), calls)
+}
+
+func TestRangePendingToolCallsWithoutTelemetry(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.AddAssistantToolCall([]aichat.ToolCall{{ID: "call_1", Type: "function", Function: aichat.Function{Name: "noop"}}})
+	err := chat.RangePendingToolCalls(func(tc *aichat.ToolCallContext) error {
+		assert.NotNil(t, tc.Context())
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,217 @@
+package aichat
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// MetaTemplate is the message meta key recording the template that rendered a message
+const MetaTemplate = "template"
+
+// TemplateInfo records the template and variables that rendered a message,
+// so that the prompt producing a conversation can be audited
+type TemplateInfo struct {
+	Name string `json:"name"`
+	// Hash identifies the template source, so that edits to a template are visible
+	Hash string `json:"hash,omitempty"`
+	// Version is the prompt version assigned by a PromptRegistry, if any
+	Version string `json:"version,omitempty"`
+	Vars    any    `json:"vars,omitempty"`
+}
+
+// Template returns the template info recorded in the message meta, or nil
+func (m *Message) Template() *TemplateInfo {
+	switch v := m.Meta().Get(MetaTemplate).(type) {
+	case nil:
+		return nil
+	case TemplateInfo:
+		return &v
+	case *TemplateInfo:
+		c := *v
+		return &c
+	case map[string]any:
+		// After a Save/Load round trip
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		var info TemplateInfo
+		if err := json.Unmarshal(b, &info); err != nil {
+			return nil
+		}
+		return &info
+	}
+	return nil
+}
+
+// Templates is a set of named prompt templates using text/template syntax.
+// Templates are executed with missingkey=error, so that a missing variable fails
+// instead of rendering "<no value>", and the output is trimmed of leading and trailing
+// whitespace, such as the final newline of template files. A Templates is safe for concurrent use.
+type Templates struct {
+	mu   sync.RWMutex
+	tmpl *template.Template
+}
+
+// NewTemplates returns an empty template set
+func NewTemplates() *Templates {
+	return &Templates{tmpl: template.New("").Option("missingkey=error")}
+}
+
+// ParseTemplateFS parses the templates matching the patterns in fsys, such as an embed.FS.
+// Each template is named by its file base name, e.g. "system.tmpl".
+func ParseTemplateFS(fsys fs.FS, patterns ...string) (*Templates, error) {
+	t := NewTemplates()
+	if _, err := t.tmpl.ParseFS(fsys, patterns...); err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	return t, nil
+}
+
+// ParseTemplateFiles parses the named template files.
+// Each template is named by its file base name, e.g. "system.tmpl".
+func ParseTemplateFiles(filenames ...string) (*Templates, error) {
+	t := NewTemplates()
+	if _, err := t.tmpl.ParseFiles(filenames...); err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	return t, nil
+}
+
+// Add parses text as the template name, replacing any template of that name
+func (t *Templates) Add(name, text string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.tmpl.New(name).Parse(text); err != nil {
+		return fmt.Errorf("failed to parse template %q: %w", name, err)
+	}
+	return nil
+}
+
+// Names returns the sorted names of the templates
+func (t *Templates) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var names []string
+	for _, tmpl := range t.tmpl.Templates() {
+		if tmpl.Name() != "" && tmpl.Tree != nil {
+			names = append(names, tmpl.Name())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Render executes the template name with data
+func (t *Templates) Render(name string, data any) (string, error) {
+	text, _, err := t.render(name, data)
+	return text, err
+}
+
+// render executes the template name and returns the output and the template hash
+func (t *Templates) render(name string, data any) (string, string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tmpl := t.tmpl.Lookup(name)
+	if tmpl == nil || tmpl.Tree == nil {
+		return "", "", fmt.Errorf("template %q not found", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("failed to render template %q: %w", name, err)
+	}
+	sum := sha256.Sum256([]byte(tmpl.Tree.Root.String()))
+	return strings.TrimSpace(buf.String()), hex.EncodeToString(sum[:6]), nil
+}
+
+// RenderMessage renders the template name into a message with the given role,
+// recording the template in the message meta under MetaTemplate
+func (t *Templates) RenderMessage(role, name string, data any) (*Message, error) {
+	text, hash, err := t.render(name, data)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{Role: role, Content: text}
+	msg.Meta().Set(MetaTemplate, TemplateInfo{Name: name, Hash: hash, Vars: data})
+	return msg, nil
+}
+
+// Prompt is a template rendered with variables of type T,
+// so that callers cannot pass the wrong variables
+type Prompt[T any] struct {
+	Templates *Templates
+	Name      string
+}
+
+// NewPrompt returns the prompt for the template name
+func NewPrompt[T any](templates *Templates, name string) Prompt[T] {
+	return Prompt[T]{Templates: templates, Name: name}
+}
+
+// Render renders the prompt
+func (p Prompt[T]) Render(data T) (string, error) {
+	return p.Templates.Render(p.Name, data)
+}
+
+// SetSystem renders the prompt as the system message of chat
+func (p Prompt[T]) SetSystem(chat *Chat, data T) (*Message, error) {
+	msg, err := p.Templates.RenderMessage("system", p.Name, data)
+	if err != nil {
+		return nil, err
+	}
+	return chat.SetSystemMessage(msg), nil
+}
+
+// AddUser renders the prompt as a user message added to chat
+func (p Prompt[T]) AddUser(chat *Chat, data T) (*Message, error) {
+	msg, err := p.Templates.RenderMessage("user", p.Name, data)
+	if err != nil {
+		return nil, err
+	}
+	return chat.addMessage(msg), nil
+}
+
+// templates returns the chat templates or an error if none are configured
+func (chat *Chat) templates() (*Templates, error) {
+	if chat.Options.Templates == nil {
+		return nil, fmt.Errorf("templates not initialized in options")
+	}
+	return chat.Options.Templates, nil
+}
+
+// SetSystemTemplate renders the template name from Options.Templates with data and sets it
+// as the system message. The template name, hash and variables are recorded in the message
+// meta under MetaTemplate. It returns nil and no error if middleware vetoed the message.
+func (chat *Chat) SetSystemTemplate(name string, data any) (*Message, error) {
+	templates, err := chat.templates()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := templates.RenderMessage("system", name, data)
+	if err != nil {
+		return nil, err
+	}
+	return chat.SetSystemMessage(msg), nil
+}
+
+// AddUserTemplate renders the template name from Options.Templates with data and adds it
+// as a user message, recording the template in the message meta like SetSystemTemplate
+func (chat *Chat) AddUserTemplate(name string, data any) (*Message, error) {
+	templates, err := chat.templates()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := templates.RenderMessage("user", name, data)
+	if err != nil {
+		return nil, err
+	}
+	return chat.addMessage(msg), nil
+}
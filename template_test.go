@@ -0,0 +1,142 @@
+package aichat_test
+
+import (
+	"context"
+	"embed"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+//go:embed testdata/prompts/*.tmpl
+var promptFS embed.FS
+
+type systemVars struct {
+	Product string
+	Tone    string
+}
+
+type questionVars struct {
+	Customer string
+	Question string
+}
+
+func TestParseTemplateFS(t *testing.T) {
+	templates, err := aichat.ParseTemplateFS(promptFS, "testdata/prompts/*.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question.tmpl", "system.tmpl"}, templates.Names())
+
+	text, err := templates.Render("system.tmpl", systemVars{Product: "Acme", Tone: "friendly"})
+	require.NoError(t, err)
+	assert.Equal(t, "You are a support agent for Acme. Answer in a friendly tone.", text)
+
+	text, err = templates.Render("system.tmpl", map[string]any{"Product": "Acme", "Tone": ""})
+	require.NoError(t, err)
+	assert.Equal(t, "You are a support agent for Acme.", text)
+
+	_, err = templates.Render("system.tmpl", map[string]any{"Product": "Acme"})
+	assert.ErrorContains(t, err, "Tone", "missing variables fail")
+
+	_, err = templates.Render("missing.tmpl", nil)
+	assert.ErrorContains(t, err, `template "missing.tmpl" not found`)
+}
+
+func TestParseTemplateFiles(t *testing.T) {
+	templates, err := aichat.ParseTemplateFiles(filepath.Join("testdata", "prompts", "question.tmpl"))
+	require.NoError(t, err)
+	text, err := templates.Render("question.tmpl", questionVars{Customer: "Ann", Question: "Where is my order?"})
+	require.NoError(t, err)
+	assert.Equal(t, "Customer Ann asks: Where is my order?", text)
+
+	_, err = aichat.ParseTemplateFiles(filepath.Join("testdata", "prompts", "missing.tmpl"))
+	assert.Error(t, err)
+}
+
+func TestTemplatesAdd(t *testing.T) {
+	templates := aichat.NewTemplates()
+	require.NoError(t, templates.Add("greeting", "Hello {{.}}"))
+	text, err := templates.Render("greeting", "world")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", text)
+
+	// Replacing a template changes its hash
+	first, err := templates.RenderMessage("system", "greeting", "world")
+	require.NoError(t, err)
+	require.NoError(t, templates.Add("greeting", "Hi {{.}}"))
+	second, err := templates.RenderMessage("system", "greeting", "world")
+	require.NoError(t, err)
+	assert.Equal(t, "Hi world", second.Content)
+	assert.NotEqual(t, first.Template().Hash, second.Template().Hash)
+
+	assert.Error(t, templates.Add("broken", "{{.Unclosed"))
+}
+
+func TestSetSystemTemplate(t *testing.T) {
+	templates, err := aichat.ParseTemplateFS(promptFS, "testdata/prompts/*.tmpl")
+	require.NoError(t, err)
+	chat := &aichat.Chat{ID: "chat-1", Options: aichat.Options{S3: newMockS3(), Templates: templates}}
+
+	chat.AddUserContent("hi")
+	msg, err := chat.SetSystemTemplate("system.tmpl", systemVars{Product: "Acme"})
+	require.NoError(t, err)
+	assert.Same(t, msg, chat.Messages[0])
+	assert.Equal(t, "system", msg.Role)
+	assert.Equal(t, "You are a support agent for Acme.", msg.Content)
+
+	info := msg.Template()
+	require.NotNil(t, info)
+	assert.Equal(t, "system.tmpl", info.Name)
+	assert.NotEmpty(t, info.Hash)
+	assert.Equal(t, systemVars{Product: "Acme"}, info.Vars)
+
+	user, err := chat.AddUserTemplate("question.tmpl", questionVars{Customer: "Ann", Question: "Refund?"})
+	require.NoError(t, err)
+	assert.Equal(t, "Customer Ann asks: Refund?", user.Content)
+	assert.Equal(t, "question.tmpl", user.Template().Name)
+
+	_, err = chat.SetSystemTemplate("missing.tmpl", nil)
+	assert.Error(t, err)
+	assert.Same(t, msg, chat.Messages[0], "failed renders leave the chat unchanged")
+
+	// The template info survives Save/Load for auditing
+	require.NoError(t, chat.Save(context.Background(), "chat-1"))
+	loaded := &aichat.Chat{Options: chat.Options}
+	require.NoError(t, loaded.Load(context.Background(), "chat-1"))
+	loadedInfo := loaded.Messages[0].Template()
+	require.NotNil(t, loadedInfo)
+	assert.Equal(t, info.Name, loadedInfo.Name)
+	assert.Equal(t, info.Hash, loadedInfo.Hash)
+	assert.Equal(t, map[string]any{"Product": "Acme", "Tone": ""}, loadedInfo.Vars)
+}
+
+func TestSetSystemTemplateWithoutTemplates(t *testing.T) {
+	chat := &aichat.Chat{}
+	_, err := chat.SetSystemTemplate("system.tmpl", nil)
+	assert.ErrorContains(t, err, "templates not initialized")
+	assert.Empty(t, chat.Messages)
+}
+
+func TestPrompt(t *testing.T) {
+	templates, err := aichat.ParseTemplateFS(promptFS, "testdata/prompts/*.tmpl")
+	require.NoError(t, err)
+	system := aichat.NewPrompt[systemVars](templates, "system.tmpl")
+	question := aichat.NewPrompt[questionVars](templates, "question.tmpl")
+
+	chat := &aichat.Chat{}
+	_, err = system.SetSystem(chat, systemVars{Product: "Acme", Tone: "formal"})
+	require.NoError(t, err)
+	_, err = question.AddUser(chat, questionVars{Customer: "Ann", Question: "Hours?"})
+	require.NoError(t, err)
+
+	require.Len(t, chat.Messages, 2)
+	assert.Equal(t, "You are a support agent for Acme. Answer in a formal tone.", chat.Messages[0].Content)
+	assert.Equal(t, "Customer Ann asks: Hours?", chat.Messages[1].Content)
+
+	text, err := question.Render(questionVars{Customer: "Bo", Question: "Why?"})
+	require.NoError(t, err)
+	assert.Equal(t, "Customer Bo asks: Why?", text)
+}
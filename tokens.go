@@ -0,0 +1,190 @@
+package aichat
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"unicode/utf8"
+)
+
+// TokenCounter counts the tokens in a piece of text
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// CacheKeyer is implemented by token counters whose counts can be cached on messages.
+// CacheKey identifies the counter and its configuration, so that counters of the same type
+// with different settings do not share counts. Counts of other counters are not cached.
+type CacheKeyer interface {
+	CacheKey() string
+}
+
+// Token overheads used when counting messages. The defaults follow the
+// OpenAI chat format and are close enough for budgeting other providers.
+var (
+	// TokensPerMessage is the framing overhead of each message
+	TokensPerMessage = 3
+	// TokensPerReply primes the assistant reply
+	TokensPerReply = 3
+	// TokensPerTool is the framing overhead of each tool definition
+	TokensPerTool = 8
+	// TokensPerImage estimates an image part
+	TokensPerImage = 765
+	// TokensPerAttachment estimates an audio, file or video part
+	TokensPerAttachment = 1000
+)
+
+// ApproxCounter estimates tokens from text length
+type ApproxCounter struct {
+	// CharsPerToken is the average number of characters per token (default 4)
+	CharsPerToken float64
+}
+
+// CountTokens implements TokenCounter
+func (c ApproxCounter) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	cpt := c.CharsPerToken
+	if cpt <= 0 {
+		cpt = 4
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / cpt))
+}
+
+// CacheKey implements CacheKeyer
+func (c ApproxCounter) CacheKey() string {
+	cpt := c.CharsPerToken
+	if cpt <= 0 {
+		cpt = 4
+	}
+	return fmt.Sprintf("approx:%g", cpt)
+}
+
+// tokenCounter returns the configured counter or the approximate default
+func (chat *Chat) tokenCounter() TokenCounter {
+	if chat.Options.TokenCounter != nil {
+		return chat.Options.TokenCounter
+	}
+	return ApproxCounter{}
+}
+
+// TokenCount returns the number of tokens the chat occupies in a request,
+// including the overhead of the given tool definitions.
+// Per-message counts are cached in message meta, see Message.TokenCount.
+func (chat *Chat) TokenCount(tools ...*Tool) int {
+	counter := chat.tokenCounter()
+	n := TokensPerReply + CountToolTokens(counter, tools)
+	for _, msg := range chat.Messages {
+		n += msg.TokenCount(counter)
+	}
+	return n
+}
+
+// TokenCount returns the number of tokens of the message using the given counter.
+// If the counter implements CacheKeyer, the count is cached on the message, neither
+// persisted nor marshaled, and recomputed when the message or the counter changes.
+// Writing the cache makes TokenCount unsafe for concurrent use on shared messages;
+// use CountMessageTokens there.
+func (m *Message) TokenCount(counter TokenCounter) int {
+	keyer, ok := counter.(CacheKeyer)
+	if !ok {
+		return CountMessageTokens(counter, m)
+	}
+	fp, err := m.tokenFingerprint(keyer.CacheKey())
+	if err == nil && m.tokens != nil && m.tokens.fingerprint == fp {
+		return m.tokens.count
+	}
+	n := CountMessageTokens(counter, m)
+	if err == nil {
+		m.tokens = &tokenCount{fingerprint: fp, count: n}
+	}
+	return n
+}
+
+// tokenCount is a cached message token count.
+// It is replaced rather than modified, so copies of a message can share it.
+type tokenCount struct {
+	fingerprint string
+	count       int
+}
+
+// tokenFingerprint identifies the message content and counter a cached count belongs to
+func (m *Message) tokenFingerprint(counterKey string) (string, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:", counterKey)
+	h.Write(b)
+	return fmt.Sprintf("%x", h.Sum64()), nil
+}
+
+// CountMessageTokens counts the tokens of a message without caching
+func CountMessageTokens(counter TokenCounter, m *Message) int {
+	n := TokensPerMessage + counter.CountTokens(m.Role)
+	if m.Name != "" {
+		n += counter.CountTokens(m.Name) + 1
+	}
+	n += countContentTokens(counter, m.Content)
+	for _, call := range m.ToolCalls {
+		n += TokensPerMessage + counter.CountTokens(call.Function.Name) + counter.CountTokens(call.Function.Arguments)
+	}
+	return n
+}
+
+func countContentTokens(counter TokenCounter, content any) int {
+	if content == nil {
+		return 0
+	}
+	if s, ok := content.(string); ok {
+		return counter.CountTokens(s)
+	}
+	parts, err := (&Message{Content: content}).ContentParts()
+	if err != nil || parts == nil {
+		b, _ := json.Marshal(content)
+		return counter.CountTokens(string(b))
+	}
+	n := 0
+	for _, p := range parts {
+		switch p.Type {
+		case PartTypeText:
+			n += counter.CountTokens(p.Text)
+		case PartTypeImageURL:
+			n += TokensPerImage
+		case PartTypeInputAudio, PartTypeFile, PartTypeVideoURL:
+			n += TokensPerAttachment
+		case PartTypeToolResult:
+			if p.ToolResult != nil {
+				n += countContentTokens(counter, p.ToolResult.Content)
+			}
+		}
+	}
+	return n
+}
+
+// CountRequestTokens counts the prompt tokens of a completion request, including tool definitions.
+// It does not use the message cache, so it is safe for concurrent use on requests that
+// share messages.
+func CountRequestTokens(counter TokenCounter, req *CompletionRequest) int {
+	n := TokensPerReply + CountToolTokens(counter, req.Tools)
+	for _, msg := range req.Messages {
+		n += CountMessageTokens(counter, msg)
+	}
+	return n
+}
+
+// CountToolTokens counts the tokens taken by tool definitions in a request
+func CountToolTokens(counter TokenCounter, tools []*Tool) int {
+	n := 0
+	for _, tool := range tools {
+		b, err := json.Marshal(tool.Function)
+		if err != nil {
+			continue
+		}
+		n += TokensPerTool + counter.CountTokens(string(b))
+	}
+	return n
+}
@@ -0,0 +1,189 @@
+package aichat_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestApproxCounter(t *testing.T) {
+	assert.Equal(t, 0, aichat.ApproxCounter{}.CountTokens(""))
+	assert.Equal(t, 1, aichat.ApproxCounter{}.CountTokens("abc"))
+	assert.Equal(t, 3, aichat.ApproxCounter{}.CountTokens("Hello, world"))
+	assert.Equal(t, 6, aichat.ApproxCounter{CharsPerToken: 2}.CountTokens("Hello, world"))
+	assert.Equal(t, 1, aichat.ApproxCounter{}.CountTokens("héé"))
+}
+
+// countingCounter counts words and records how often it is called
+type countingCounter struct{ calls int }
+
+func (c *countingCounter) CountTokens(text string) int {
+	c.calls++
+	return len(strings.Fields(text))
+}
+
+func (c *countingCounter) CacheKey() string { return "words" }
+
+// uncachedCounter counts words without a cache key
+type uncachedCounter struct{ calls int }
+
+func (c *uncachedCounter) CountTokens(text string) int {
+	c.calls++
+	return len(strings.Fields(text))
+}
+
+func TestTokenCountCacheKey(t *testing.T) {
+	msg := &aichat.Message{Role: "user", Content: "What is the weather like in Boston today?"}
+
+	// Counters of the same type with different settings do not share counts
+	n := msg.TokenCount(aichat.ApproxCounter{})
+	assert.Equal(t, aichat.CountMessageTokens(aichat.ApproxCounter{}, msg), n)
+	one := aichat.ApproxCounter{CharsPerToken: 1}
+	assert.Equal(t, aichat.CountMessageTokens(one, msg), msg.TokenCount(one))
+	assert.NotEqual(t, n, msg.TokenCount(one))
+	assert.Equal(t, n, msg.TokenCount(aichat.ApproxCounter{CharsPerToken: 4}))
+
+	// Counters without a cache key are not cached
+	counter := &uncachedCounter{}
+	plain := &aichat.Message{Role: "user", Content: "one two three"}
+	assert.Equal(t, aichat.TokensPerMessage+1+3, plain.TokenCount(counter))
+	assert.Equal(t, aichat.TokensPerMessage+1+3, plain.TokenCount(counter))
+	assert.Equal(t, 4, counter.calls)
+
+	req := &aichat.CompletionRequest{Messages: []*aichat.Message{plain}}
+	assert.Equal(t, aichat.TokensPerMessage+1+3+aichat.TokensPerReply, aichat.CountRequestTokens(&countingCounter{}, req))
+}
+
+func TestChatTokenCount(t *testing.T) {
+	counter := &countingCounter{}
+	chat := &aichat.Chat{Options: aichat.Options{TokenCounter: counter}}
+	chat.SetSystemContent("You are helpful")
+	user := chat.AddUserContent("What is the weather")
+	chat.AddAssistantToolCall([]aichat.ToolCall{{
+		ID:       "call-1",
+		Function: aichat.Function{Name: "get_weather", Arguments: `{"location": "Boston"}`},
+	}})
+	chat.AddToolContent("get_weather", "call-1", "sunny")
+
+	// system: 3+1+3, user: 3+1+4, assistant: 3+1+(3+1+2), tool: 3+1+(1+1)+1, reply: 3
+	assert.Equal(t, 7+8+10+7+3, chat.TokenCount())
+
+	// Counts are cached on the messages, outside their meta
+	calls := counter.calls
+	assert.Equal(t, 35, chat.TokenCount())
+	assert.Equal(t, calls, counter.calls)
+	assert.Nil(t, user.Meta().Get("token_count"))
+
+	// and recomputed when the message changes
+	user.Content = "What is the weather in Boston"
+	assert.Equal(t, 37, chat.TokenCount())
+
+	// Tool definitions add overhead
+	tool := &aichat.Tool{Type: "function", Function: aichat.Function{Name: "get_weather", Description: "Get the weather"}}
+	assert.Greater(t, chat.TokenCount(tool), 37+aichat.TokensPerTool)
+}
+
+func TestTokenCountCacheNotPersisted(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	counter := &countingCounter{}
+	chat := &aichat.Chat{Options: aichat.Options{S3: s3, TokenCounter: counter}}
+	chat.AddUserContent("one two three")
+	n := chat.TokenCount()
+	require.NoError(t, chat.Save(ctx, "tokens"))
+
+	raw, ok := s3.GetRawData("tokens")
+	require.True(t, ok)
+	assert.NotContains(t, string(raw), "fingerprint")
+
+	// Loaded chats count again, and so do clones once their messages change
+	loaded := &aichat.Chat{Options: aichat.Options{S3: s3, TokenCounter: counter}}
+	require.NoError(t, loaded.Load(ctx, "tokens"))
+	calls := counter.calls
+	assert.Equal(t, n, loaded.TokenCount())
+	assert.Greater(t, counter.calls, calls)
+
+	clone := chat.Clone()
+	clone.Messages[0].Content = "one two three four"
+	assert.Equal(t, n+1, clone.TokenCount())
+	assert.Equal(t, n, chat.TokenCount())
+}
+
+func TestCountMessageTokensParts(t *testing.T) {
+	counter := aichat.ApproxCounter{CharsPerToken: 1}
+	msg := &aichat.Message{Role: "user"}
+	msg.SetContentParts(
+		aichat.TextPart("abcd"),
+		aichat.ImagePart("https://example.com/cat.jpg"),
+		aichat.FileIDPart("file-1"),
+		aichat.ToolResultPart("call-1", "ok"),
+	)
+	want := aichat.TokensPerMessage + 4 + 4 + aichat.TokensPerImage + aichat.TokensPerAttachment + 2
+	assert.Equal(t, want, aichat.CountMessageTokens(counter, msg))
+
+	msg.Content = map[string]any{"a": 1}
+	assert.Equal(t, aichat.TokensPerMessage+4+len(`{"a":1}`), aichat.CountMessageTokens(counter, msg))
+
+	msg.Content = nil
+	assert.Equal(t, aichat.TokensPerMessage+4, aichat.CountMessageTokens(counter, msg))
+}
+
+func writeVocab(t *testing.T, tokens ...string) string {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, tok := range tokens {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), 256+i)
+	}
+	path := filepath.Join(t.TempDir(), "vocab.tiktoken")
+	require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o644))
+	return path
+}
+
+func TestBPECounter(t *testing.T) {
+	counter, err := aichat.LoadBPE(writeVocab(t, "he", "ll", "hell", "hello", " w", " wo", "rl", " wor", " worl", " world"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, counter.CountTokens(""))
+	assert.Equal(t, 1, counter.CountTokens("hello"))
+	assert.Equal(t, 2, counter.CountTokens("hello world"))
+	assert.Equal(t, 3, counter.CountTokens("hello world!"))
+	assert.Equal(t, 3, counter.CountTokens("help"))     // he, l, p
+	assert.Equal(t, 2, counter.CountTokens("é"))        // two bytes without merges
+	assert.Equal(t, 4, counter.CountTokens("hello 12")) // hello, " ", "1", "2"
+
+	chat := &aichat.Chat{Options: aichat.Options{TokenCounter: counter}}
+	chat.AddUserContent("hello world")
+	assert.Equal(t, aichat.TokensPerMessage+4+2+aichat.TokensPerReply, chat.TokenCount())
+
+	// Different vocabularies do not share cached counts
+	other, err := aichat.LoadBPE(writeVocab(t))
+	require.NoError(t, err)
+	assert.NotEqual(t, counter.CacheKey(), other.CacheKey())
+	assert.Equal(t, aichat.TokensPerMessage+4+11, chat.Messages[0].TokenCount(other))
+}
+
+func TestReadBPEErrors(t *testing.T) {
+	_, err := aichat.LoadBPE(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	for _, vocab := range []string{"aGVsbG8=", "!!! 1", "aGVsbG8= x"} {
+		_, err := aichat.ReadBPE(strings.NewReader(vocab))
+		assert.Error(t, err, vocab)
+	}
+
+	counter, err := aichat.ReadBPE(strings.NewReader("aGVsbG8= 0\n\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counter.CountTokens("hello"))
+}
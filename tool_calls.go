@@ -1,8 +1,10 @@
 package aichat
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 )
 
 // ToolCall represents a call to an external tool or function
@@ -17,33 +19,65 @@ type ToolCall struct {
 // It performs two passes: first to identify which tool calls have responses, then to process pending calls.
 // The provided function is called for each pending tool call.
 func (chat *Chat) RangePendingToolCalls(fn func(toolCallContext *ToolCallContext) error) error {
-	// Create a map to track which tool calls have responses
-	responded := make(map[string]bool)
+	return chat.RangePendingToolCallsContext(context.Background(), fn)
+}
 
-	// First pass: identify which tool calls have responses
-	chat.RangeByRole("tool", func(msg *Message) error {
-		if msg.ToolCallID != "" {
-			responded[msg.ToolCallID] = true
+// RangePendingToolCallsContext is like RangePendingToolCalls with a context for the tool calls.
+// If Options.Telemetry is set, each call runs in an execute_tool span that is a child of ctx,
+// and if Options.Logging is set, each call is logged.
+func (chat *Chat) RangePendingToolCallsContext(ctx context.Context, fn func(toolCallContext *ToolCallContext) error) error {
+	dispatch := fn
+	if l := chat.Options.Logging; l != nil {
+		dispatch = func(tcc *ToolCallContext) error {
+			return l.logTool(tcc.Context(), tcc, fn)
 		}
-		return nil
-	})
+	}
 
-	// Second pass: process pending tool calls
-	return chat.RangeByRole("assistant", func(msg *Message) error {
-		for _, call := range msg.ToolCalls {
-			if responded[call.ID] {
-				continue
+	for tcc := range chat.pendingToolCalls(ctx) {
+		var err error
+		if t := chat.Options.Telemetry; t != nil {
+			err = t.traceTool(ctx, tcc, dispatch)
+		} else {
+			err = dispatch(tcc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingToolCalls returns an iterator over the tool calls that haven't received a response,
+// in the order they were made. Responses added while iterating do not affect the iteration.
+// Unlike RangePendingToolCallsContext, it does not trace or log the calls.
+func (chat *Chat) PendingToolCalls() iter.Seq[*ToolCallContext] {
+	return chat.pendingToolCalls(context.Background())
+}
+
+// pendingToolCalls yields the pending tool calls with the given context
+func (chat *Chat) pendingToolCalls(ctx context.Context) iter.Seq[*ToolCallContext] {
+	return func(yield func(*ToolCallContext) bool) {
+		// First pass: identify which tool calls have responses
+		responded := make(map[string]bool)
+		for _, msg := range chat.ByRole("tool") {
+			if msg.ToolCallID != "" {
+				responded[msg.ToolCallID] = true
 			}
-			if err := fn(&ToolCallContext{
-				Chat:     chat,
-				ToolCall: &call,
-			}); err != nil {
-				return err
+		}
+
+		// Second pass: yield pending tool calls
+		for _, msg := range chat.ByRole("assistant") {
+			for _, call := range msg.ToolCalls {
+				if responded[call.ID] {
+					continue
+				}
+				responded[call.ID] = true
+				if !yield(&ToolCallContext{Chat: chat, ToolCall: &call, ctx: ctx}) {
+					return
+				}
 			}
-			responded[call.ID] = true
 		}
-		return nil
-	})
+	}
 }
 
 // ToolCallContext represents a tool call within a chat context, managing the lifecycle
@@ -51,6 +85,16 @@ func (chat *Chat) RangePendingToolCalls(fn func(toolCallContext *ToolCallContext
 type ToolCallContext struct {
 	ToolCall *ToolCall
 	Chat     *Chat
+
+	ctx context.Context
+}
+
+// Context returns the context of the tool call, carrying its span when traced
+func (tcc *ToolCallContext) Context() context.Context {
+	if tcc.ctx == nil {
+		return context.Background()
+	}
+	return tcc.ctx
 }
 
 // Name returns the name of the function
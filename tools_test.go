@@ -38,10 +38,7 @@ func TestContentParts(t *testing.T) {
 				},
 				{
 					Type: "image_url",
-					ImageURL: struct {
-						URL    string `json:"url"`
-						Detail string `json:"detail,omitempty"`
-					}{
+					ImageURL: &aichat.ImageURL{
 						URL:    "https://example.com/image.jpg",
 						Detail: "high",
 					},
@@ -0,0 +1,175 @@
+package aichat
+
+import "sort"
+
+// Truncator produces a trimmed view of chat messages.
+// Implementations must not modify the messages they are given, other than caching token counts.
+type Truncator interface {
+	Truncate(messages []*Message) []*Message
+}
+
+// TruncatorFunc adapts a function to the Truncator interface
+type TruncatorFunc func(messages []*Message) []*Message
+
+// Truncate implements Truncator
+func (fn TruncatorFunc) Truncate(messages []*Message) []*Message {
+	return fn(messages)
+}
+
+// TruncatedToolOutput replaces tool outputs dropped by DropLargeToolOutputs
+var TruncatedToolOutput = "[tool output truncated]"
+
+// Truncated returns a trimmed view of the chat messages without modifying the chat
+func (chat *Chat) Truncated(t Truncator) []*Message {
+	return t.Truncate(chat.Messages)
+}
+
+// Chain applies truncators in order, each to the output of the previous one
+func Chain(truncators ...Truncator) Truncator {
+	return TruncatorFunc(func(messages []*Message) []*Message {
+		for _, t := range truncators {
+			messages = t.Truncate(messages)
+		}
+		return messages
+	})
+}
+
+// KeepLastTurns keeps system messages and the last n turns, where a turn starts at a user message
+func KeepLastTurns(n int) Truncator {
+	return TruncatorFunc(func(messages []*Message) []*Message {
+		start := len(messages)
+		for i := len(messages) - 1; i >= 0 && n > 0; i-- {
+			if messages[i].Role == "user" {
+				start = i
+				n--
+			}
+		}
+		keep := make([]bool, len(messages))
+		for i, msg := range messages {
+			keep[i] = i >= start || msg.Role == "system"
+		}
+		return keepWhole(messages, keep)
+	})
+}
+
+// DropOldest drops the oldest messages until the view fits in budget tokens.
+// System messages and the last message (with its tool call group) are always kept.
+// A nil counter defaults to ApproxCounter.
+func DropOldest(budget int, counter TokenCounter) Truncator {
+	if counter == nil {
+		counter = ApproxCounter{}
+	}
+	return TruncatorFunc(func(messages []*Message) []*Message {
+		if len(messages) == 0 {
+			return messages
+		}
+		groups := groupToolCalls(messages)
+		lastGroup := groups[len(groups)-1]
+		var members [][]int
+		keep := make([]bool, len(messages))
+		total := TokensPerReply
+		for i, msg := range messages {
+			if groups[i] == len(members) {
+				members = append(members, nil)
+			}
+			members[groups[i]] = append(members[groups[i]], i)
+			keep[i] = true
+			total += msg.TokenCount(counter)
+		}
+		for g := 0; g < lastGroup && total > budget; g++ {
+			for _, i := range members[g] {
+				if messages[i].Role != "system" {
+					keep[i] = false
+					total -= messages[i].TokenCount(counter)
+				}
+			}
+		}
+		return keepWhole(messages, keep)
+	})
+}
+
+// DropLargeToolOutputs replaces the largest tool outputs with TruncatedToolOutput
+// until the view fits in budget tokens. Tool messages are kept so that no tool call
+// is left without a response. A nil counter defaults to ApproxCounter.
+func DropLargeToolOutputs(budget int, counter TokenCounter) Truncator {
+	if counter == nil {
+		counter = ApproxCounter{}
+	}
+	return TruncatorFunc(func(messages []*Message) []*Message {
+		out := make([]*Message, len(messages))
+		copy(out, messages)
+		total := TokensPerReply
+		var tools []int
+		for i, msg := range messages {
+			total += msg.TokenCount(counter)
+			if msg.Role == "tool" {
+				tools = append(tools, i)
+			}
+		}
+		sort.SliceStable(tools, func(a, b int) bool {
+			return messages[tools[a]].TokenCount(counter) > messages[tools[b]].TokenCount(counter)
+		})
+		for _, i := range tools {
+			if total <= budget {
+				break
+			}
+			m := messages[i].shallowCopy()
+			m.Content = TruncatedToolOutput
+			total += CountMessageTokens(counter, m) - messages[i].TokenCount(counter)
+			out[i] = m
+		}
+		return out
+	})
+}
+
+// groupToolCalls assigns each message to a group, in order of first appearance.
+// Tool messages join the group of the assistant message that called them;
+// every other message starts its own group.
+func groupToolCalls(messages []*Message) []int {
+	groups := make([]int, len(messages))
+	callGroup := make(map[string]int)
+	n := 0
+	for i, msg := range messages {
+		if g, ok := callGroup[msg.ToolCallID]; ok && msg.Role == "tool" {
+			groups[i] = g
+			continue
+		}
+		groups[i] = n
+		for _, call := range msg.ToolCalls {
+			callGroup[call.ID] = n
+		}
+		n++
+	}
+	return groups
+}
+
+// keepWhole returns the kept messages, dropping tool call groups that are only partially kept
+// so that no tool message is orphaned from its assistant tool calls or vice versa
+func keepWhole(messages []*Message, keep []bool) []*Message {
+	groups := groupToolCalls(messages)
+	partial := make(map[int]bool)
+	for i := range messages {
+		if !keep[i] {
+			partial[groups[i]] = true
+		}
+	}
+	out := make([]*Message, 0, len(messages))
+	for i, msg := range messages {
+		if keep[i] && !partial[groups[i]] {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// shallowCopy copies the message and its meta map, sharing content and tool calls
+func (m *Message) shallowCopy() *Message {
+	c := *m
+	if m.meta != nil {
+		c.meta = make(map[string]any, len(m.meta))
+		for k, v := range m.meta {
+			c.meta[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,109 @@
+package aichat_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/presbrey/aichat"
+)
+
+// newToolChat builds a chat with two turns, the first using a tool with a large output
+func newToolChat() *aichat.Chat {
+	chat := new(aichat.Chat)
+	chat.SetSystemContent("system")
+	chat.AddUserContent("first question")
+	chat.AddAssistantToolCall([]aichat.ToolCall{{ID: "call-1", Function: aichat.Function{Name: "search"}}})
+	chat.AddToolContent("search", "call-1", strings.Repeat("result ", 100))
+	chat.AddAssistantContent("first answer")
+	chat.AddUserContent("second question")
+	chat.AddAssistantContent("second answer")
+	return chat
+}
+
+func roles(messages []*aichat.Message) []string {
+	out := make([]string, len(messages))
+	for i, msg := range messages {
+		out[i] = msg.Role
+	}
+	return out
+}
+
+func TestKeepLastTurns(t *testing.T) {
+	chat := newToolChat()
+
+	view := chat.Truncated(aichat.KeepLastTurns(1))
+	assert.Equal(t, []string{"system", "user", "assistant"}, roles(view))
+	assert.Equal(t, "second question", view[1].Content)
+
+	view = chat.Truncated(aichat.KeepLastTurns(2))
+	assert.Equal(t, chat.Messages, view)
+
+	view = chat.Truncated(aichat.KeepLastTurns(0))
+	assert.Equal(t, []string{"system"}, roles(view))
+
+	// Stored history is untouched
+	assert.Equal(t, 7, chat.MessageCount())
+}
+
+func TestKeepLastTurnsNeverOrphans(t *testing.T) {
+	// A tool response separated from its call by a user message
+	chat := new(aichat.Chat)
+	chat.AddUserContent("start")
+	chat.AddAssistantToolCall([]aichat.ToolCall{{ID: "call-1", Function: aichat.Function{Name: "slow"}}})
+	chat.AddUserContent("still there?")
+	chat.AddToolContent("slow", "call-1", "done")
+	chat.AddAssistantContent("done")
+
+	view := chat.Truncated(aichat.KeepLastTurns(1))
+	assert.Equal(t, []string{"user", "assistant"}, roles(view))
+	for _, msg := range view {
+		assert.NotEqual(t, "tool", msg.Role)
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	counter := aichat.ApproxCounter{}
+	chat := newToolChat()
+	full := chat.TokenCount()
+
+	// Everything fits
+	assert.Equal(t, chat.Messages, chat.Truncated(aichat.DropOldest(full, counter)))
+
+	// Dropping the tool call group drops the call and its response together
+	view := chat.Truncated(aichat.DropOldest(full-10, nil))
+	assert.Equal(t, []string{"system", "assistant", "user", "assistant"}, roles(view))
+
+	// System messages and the last message are always kept
+	view = chat.Truncated(aichat.DropOldest(0, counter))
+	assert.Equal(t, []string{"system", "assistant"}, roles(view))
+
+	assert.Empty(t, aichat.DropOldest(0, counter).Truncate(nil))
+	assert.Equal(t, 7, chat.MessageCount())
+}
+
+func TestDropLargeToolOutputs(t *testing.T) {
+	chat := newToolChat()
+	full := chat.TokenCount()
+	tool := chat.Messages[3]
+	tool.Meta().Set("source", "search")
+
+	view := chat.Truncated(aichat.DropLargeToolOutputs(full-10, nil))
+	assert.Equal(t, roles(chat.Messages), roles(view))
+	assert.Equal(t, aichat.TruncatedToolOutput, view[3].Content)
+	assert.Equal(t, "call-1", view[3].ToolCallID)
+	assert.Equal(t, "search", view[3].Meta().Get("source"))
+
+	// The stored tool output is untouched
+	assert.Equal(t, strings.Repeat("result ", 100), tool.Content)
+
+	// Nothing is replaced when the chat fits
+	view = chat.Truncated(aichat.DropLargeToolOutputs(full, nil))
+	assert.Same(t, tool, view[3])
+
+	// Chained with DropOldest when replacing outputs is not enough
+	budget := 30
+	view = chat.Truncated(aichat.Chain(aichat.DropLargeToolOutputs(budget, nil), aichat.DropOldest(budget, nil)))
+	assert.LessOrEqual(t, (&aichat.Chat{Messages: view}).TokenCount(), budget)
+}
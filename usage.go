@@ -0,0 +1,187 @@
+package aichat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetaUsage is the message meta key recording the token usage of an assistant message
+const MetaUsage = "usage"
+
+// Usage is the token usage and cost of one or more model calls
+type Usage struct {
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	// CachedTokens is the part of PromptTokens read from the provider prompt cache
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// ReasoningTokens is the part of CompletionTokens spent on reasoning
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+	TotalTokens     int `json:"total_tokens,omitempty"`
+	// Cost is the cost reported by the provider or computed from a PriceTable
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// Add adds the token counts and cost of o to u
+func (u *Usage) Add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.CachedTokens += o.CachedTokens
+	u.ReasoningTokens += o.ReasoningTokens
+	u.TotalTokens += o.TotalTokens
+	u.Cost += o.Cost
+}
+
+// IsZero reports whether no tokens or cost are recorded
+func (u Usage) IsZero() bool {
+	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0 && u.Cost == 0
+}
+
+// SetUsage records the usage of the message in its meta
+func (m *Message) SetUsage(u Usage) {
+	m.Meta().Set(MetaUsage, u)
+}
+
+// Usage returns the usage recorded in the message meta, or nil
+func (m *Message) Usage() *Usage {
+	return decodeUsage(m.Meta().Get(MetaUsage))
+}
+
+// decodeUsage reads a usage meta value, which is a map after a Save/Load round trip
+func decodeUsage(v any) *Usage {
+	switch u := v.(type) {
+	case nil:
+		return nil
+	case Usage:
+		return &u
+	case *Usage:
+		c := *u
+		return &c
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var u Usage
+	if err := json.Unmarshal(b, &u); err != nil {
+		return nil
+	}
+	return &u
+}
+
+// Price is the price of a model in currency units per million tokens
+type Price struct {
+	Prompt     float64 `yaml:"prompt" json:"prompt"`
+	Completion float64 `yaml:"completion" json:"completion"`
+	// CachedPrompt is the price of cached prompt tokens (default Prompt)
+	CachedPrompt float64 `yaml:"cached_prompt,omitempty" json:"cached_prompt,omitempty"`
+}
+
+// PriceTable maps model names to prices
+type PriceTable map[string]Price
+
+// LoadPriceTable loads a price table from a YAML or JSON file
+func LoadPriceTable(path string) (PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	return ParsePriceTable(data)
+}
+
+// ParsePriceTable parses a price table in YAML or JSON
+func ParsePriceTable(data []byte) (PriceTable, error) {
+	var table PriceTable
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %w", err)
+	}
+	return table, nil
+}
+
+// Lookup returns the price of a model. A provider prefix such as "openai/"
+// is ignored if the full name is not in the table.
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if p, ok := t[model]; ok {
+		return p, true
+	}
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		p, ok := t[name]
+		return p, ok
+	}
+	return Price{}, false
+}
+
+// Cost computes the cost of a usage from the price of its model
+func (t PriceTable) Cost(u Usage) (float64, bool) {
+	p, ok := t.Lookup(u.Model)
+	if !ok {
+		return 0, false
+	}
+	cached := p.CachedPrompt
+	if cached == 0 {
+		cached = p.Prompt
+	}
+	cost := float64(u.PromptTokens-u.CachedTokens)*p.Prompt +
+		float64(u.CachedTokens)*cached +
+		float64(u.CompletionTokens)*p.Completion
+	return cost / 1e6, true
+}
+
+// UsageTotals aggregates the usage of a chat
+type UsageTotals struct {
+	Usage
+	// Models breaks the totals down by model
+	Models map[string]*Usage
+	// Calls is the number of messages with recorded usage
+	Calls int
+}
+
+// Usage aggregates the recorded usage of every message of the chat, including inactive
+// branches and messages replaced by compaction. Messages without a provider-reported cost
+// are priced with Options.Prices when their model is listed.
+func (chat *Chat) Usage() *UsageTotals {
+	totals := &UsageTotals{Models: make(map[string]*Usage)}
+	add := func(u *Usage) {
+		if u == nil {
+			return
+		}
+		if u.Cost == 0 && chat.Options.Prices != nil {
+			u.Cost, _ = chat.Options.Prices.Cost(*u)
+		}
+		totals.Add(*u)
+		totals.Calls++
+		model := totals.Models[u.Model]
+		if model == nil {
+			model = &Usage{Model: u.Model}
+			totals.Models[u.Model] = model
+		}
+		model.Add(*u)
+	}
+
+	messages := append(chat.Messages[:len(chat.Messages):len(chat.Messages)], chat.inactiveMessages()...)
+	for _, u := range messageUsages(messages) {
+		add(decodeUsage(u))
+	}
+	return totals
+}
+
+// messageUsages returns the usage recorded on messages, including the usage
+// carried by compaction summaries of the messages they replaced
+func messageUsages(messages []*Message) []any {
+	var usages []any
+	for _, msg := range messages {
+		if u := msg.Meta().Get(MetaUsage); u != nil {
+			usages = append(usages, u)
+		}
+		if tag, ok := msg.Meta().Get(MetaCompaction).(map[string]any); ok {
+			if carried, ok := tag["usage"].([]any); ok {
+				usages = append(usages, carried...)
+			}
+		}
+	}
+	return usages
+}
@@ -0,0 +1,98 @@
+package aichat_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func TestPriceTable(t *testing.T) {
+	prices, err := aichat.ParsePriceTable([]byte(`
+gpt-4o:
+  prompt: 2.5
+  completion: 10
+  cached_prompt: 1.25
+claude-3-5-sonnet:
+  prompt: 3
+  completion: 15
+`))
+	require.NoError(t, err)
+
+	cost, ok := prices.Cost(aichat.Usage{Model: "openai/gpt-4o", PromptTokens: 1000000, CachedTokens: 400000, CompletionTokens: 100000})
+	require.True(t, ok)
+	assert.InDelta(t, 0.6*2.5+0.4*1.25+0.1*10, cost, 1e-9)
+
+	cost, ok = prices.Cost(aichat.Usage{Model: "claude-3-5-sonnet", PromptTokens: 1000, CachedTokens: 1000})
+	require.True(t, ok)
+	assert.InDelta(t, 0.003, cost, 1e-9)
+
+	_, ok = prices.Cost(aichat.Usage{Model: "unknown"})
+	assert.False(t, ok)
+
+	// JSON files are loaded too
+	path := filepath.Join(t.TempDir(), "prices.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"gpt-4o-mini": {"prompt": 0.15, "completion": 0.6}}`), 0o644))
+	prices, err = aichat.LoadPriceTable(path)
+	require.NoError(t, err)
+	assert.Equal(t, aichat.Price{Prompt: 0.15, Completion: 0.6}, prices["gpt-4o-mini"])
+
+	_, err = aichat.LoadPriceTable(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+	_, err = aichat.ParsePriceTable([]byte(`[1, 2]`))
+	assert.Error(t, err)
+}
+
+func TestChatUsage(t *testing.T) {
+	ctx := context.Background()
+	s3 := newMockS3()
+	chat := &aichat.Chat{Options: aichat.Options{
+		S3:     s3,
+		Prices: aichat.PriceTable{"gpt-4o": {Prompt: 2, Completion: 8}},
+	}}
+	chat.AddUserContent("hello")
+	chat.AddAssistantContent("hi").SetUsage(aichat.Usage{Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500})
+	chat.AddUserContent("think hard")
+	chat.AddAssistantContent("done").SetUsage(aichat.Usage{Model: "o1", PromptTokens: 2000, CompletionTokens: 1000, ReasoningTokens: 800, TotalTokens: 3000, Cost: 0.25})
+
+	usage := chat.Usage()
+	assert.Equal(t, 2, usage.Calls)
+	assert.Equal(t, 3000, usage.PromptTokens)
+	assert.Equal(t, 1500, usage.CompletionTokens)
+	assert.Equal(t, 800, usage.ReasoningTokens)
+	assert.Equal(t, 4500, usage.TotalTokens)
+	assert.InDelta(t, 0.002+0.004+0.25, usage.Cost, 1e-9)
+	assert.InDelta(t, 0.006, usage.Models["gpt-4o"].Cost, 1e-9)
+	assert.Equal(t, 800, usage.Models["o1"].ReasoningTokens)
+
+	// Usage is persisted with the chat
+	require.NoError(t, chat.Save(ctx, "usage"))
+	loaded := &aichat.Chat{Options: chat.Options}
+	require.NoError(t, loaded.Load(ctx, "usage"))
+	assert.Equal(t, usage, loaded.Usage())
+	assert.Equal(t, &aichat.Usage{Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500}, loaded.Messages[1].Usage())
+	assert.Nil(t, loaded.Messages[0].Usage())
+
+	// Retried branches and compacted messages still count
+	loaded.BranchAt(3)
+	loaded.AddAssistantContent("retry").SetUsage(aichat.Usage{Model: "o1", Cost: 0.05})
+	compactor := &aichat.Compactor{Summarize: func(ctx context.Context, msgs []*aichat.Message) (string, error) {
+		return "summary", nil
+	}}
+	compacted, err := compactor.Compact(ctx, loaded)
+	require.NoError(t, err)
+	require.True(t, compacted)
+	assert.Len(t, loaded.Messages, 2)
+	assert.Equal(t, 3, loaded.Usage().Calls)
+	assert.InDelta(t, 0.306, loaded.Usage().Cost, 1e-9)
+
+	require.NoError(t, loaded.Save(ctx, "usage"))
+	reloaded := &aichat.Chat{Options: chat.Options}
+	require.NoError(t, reloaded.Load(ctx, "usage"))
+	assert.InDelta(t, 0.306, reloaded.Usage().Cost, 1e-9)
+}
@@ -0,0 +1,238 @@
+package aichat
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ProblemKind classifies a transcript problem found by Validate
+type ProblemKind string
+
+// Transcript problems rejected by providers
+const (
+	// ProblemOrphanToolResult is a tool message that does not answer a tool call of a preceding assistant message
+	ProblemOrphanToolResult ProblemKind = "orphan_tool_result"
+	// ProblemUnansweredToolCall is a tool call without a tool message answering it
+	ProblemUnansweredToolCall ProblemKind = "unanswered_tool_call"
+	// ProblemConsecutiveRole is a user or assistant message following a message of the same role
+	ProblemConsecutiveRole ProblemKind = "consecutive_role"
+	// ProblemMisplacedSystem is a system message that is not the first message
+	ProblemMisplacedSystem ProblemKind = "misplaced_system"
+)
+
+// Problem is a transcript problem found by Validate
+type Problem struct {
+	Kind ProblemKind
+	// Index is the index of the offending message in Chat.Messages
+	Index int
+	// MessageID is the ID of the offending message
+	MessageID string
+	// ToolCallID is the tool call of orphan tool results and unanswered tool calls
+	ToolCallID string
+}
+
+// String describes the problem
+func (p Problem) String() string {
+	switch p.Kind {
+	case ProblemOrphanToolResult:
+		return fmt.Sprintf("message %d: tool result %q does not answer a preceding tool call", p.Index, p.ToolCallID)
+	case ProblemUnansweredToolCall:
+		return fmt.Sprintf("message %d: tool call %q has no tool result", p.Index, p.ToolCallID)
+	case ProblemConsecutiveRole:
+		return fmt.Sprintf("message %d: same role as the previous message", p.Index)
+	case ProblemMisplacedSystem:
+		return fmt.Sprintf("message %d: system message is not the first message", p.Index)
+	}
+	return fmt.Sprintf("message %d: %s", p.Index, p.Kind)
+}
+
+// Validate returns the problems of the transcript that providers reject, in message order.
+// Tool calls are expected to be answered by tool messages following the assistant message
+// that made them, before the next user or assistant message.
+func (chat *Chat) Validate() []Problem {
+	var problems []Problem
+	pending := map[string]int{} // unanswered tool call ID -> index of the assistant message
+	var order []string          // pending tool call IDs in call order
+	flush := func() {
+		for _, id := range order {
+			if i, ok := pending[id]; ok {
+				problems = append(problems, Problem{
+					Kind: ProblemUnansweredToolCall, Index: i, MessageID: chat.Messages[i].ID, ToolCallID: id,
+				})
+			}
+		}
+		clear(pending)
+		order = order[:0]
+	}
+
+	for i, msg := range chat.Messages {
+		if msg.Role != "tool" {
+			flush()
+		}
+		switch msg.Role {
+		case "system":
+			if i > 0 {
+				problems = append(problems, Problem{Kind: ProblemMisplacedSystem, Index: i, MessageID: msg.ID})
+			}
+		case "tool":
+			if _, ok := pending[msg.ToolCallID]; !ok {
+				problems = append(problems, Problem{
+					Kind: ProblemOrphanToolResult, Index: i, MessageID: msg.ID, ToolCallID: msg.ToolCallID,
+				})
+			}
+			delete(pending, msg.ToolCallID)
+		case "user", "assistant":
+			if i > 0 && chat.Messages[i-1].Role == msg.Role {
+				problems = append(problems, Problem{Kind: ProblemConsecutiveRole, Index: i, MessageID: msg.ID})
+			}
+			for _, call := range msg.ToolCalls {
+				pending[call.ID] = i
+				order = append(order, call.ID)
+			}
+		}
+	}
+	flush()
+	return problems
+}
+
+// RepairPolicy selects how Repair fixes transcript problems
+type RepairPolicy struct {
+	// AnswerToolCalls inserts a tool message with PlaceholderResult after the results of
+	// each assistant message for its unanswered tool calls
+	AnswerToolCalls bool
+	// PlaceholderResult is the content of inserted tool results (default DefaultPlaceholderResult)
+	PlaceholderResult string
+	// DropOrphanToolResults removes tool messages that do not answer a preceding tool call
+	DropOrphanToolResults bool
+	// MergeUserMessages merges consecutive user messages into one
+	MergeUserMessages bool
+	// MergeSystemMessages merges misplaced system messages into a first system message
+	MergeSystemMessages bool
+}
+
+// DefaultPlaceholderResult is the default content of tool results inserted by Repair
+const DefaultPlaceholderResult = `{"error":"no result"}`
+
+// DefaultRepairPolicy fixes every problem that Repair can fix
+var DefaultRepairPolicy = RepairPolicy{
+	AnswerToolCalls:       true,
+	DropOrphanToolResults: true,
+	MergeUserMessages:     true,
+	MergeSystemMessages:   true,
+}
+
+// Repair fixes the transcript problems selected by the policy and returns the problems that
+// remain, such as consecutive assistant messages. Merged messages are replaced by copies that
+// keep the ID of the first message, so the original messages are not modified.
+// Repair does not run middleware; observers are notified of the removed and added messages.
+func (chat *Chat) Repair(policy RepairPolicy) []Problem {
+	problems := chat.Validate()
+	if len(problems) == 0 {
+		return nil
+	}
+	placeholder := policy.PlaceholderResult
+	if placeholder == "" {
+		placeholder = DefaultPlaceholderResult
+	}
+
+	drop := map[int]bool{}
+	unanswered := map[int][]ToolCall{} // assistant index -> unanswered calls
+	for _, p := range problems {
+		switch {
+		case p.Kind == ProblemOrphanToolResult && policy.DropOrphanToolResults:
+			drop[p.Index] = true
+		case p.Kind == ProblemUnansweredToolCall && policy.AnswerToolCalls:
+			for _, call := range chat.Messages[p.Index].ToolCalls {
+				if call.ID == p.ToolCallID {
+					unanswered[p.Index] = append(unanswered[p.Index], call)
+				}
+			}
+		}
+	}
+
+	var out []*Message
+	answer := func(assistant int) {
+		for _, call := range unanswered[assistant] {
+			msg := &Message{Role: "tool", Name: call.Function.Name, ToolCallID: call.ID, Content: placeholder}
+			msg.ensureID()
+			out = append(out, msg)
+		}
+	}
+	lastAssistant := -1
+	for i, msg := range chat.Messages {
+		if drop[i] {
+			continue
+		}
+		if msg.Role != "tool" && lastAssistant >= 0 {
+			answer(lastAssistant)
+			lastAssistant = -1
+		}
+		if msg.Role == "assistant" {
+			lastAssistant = i
+		}
+		if len(out) > 0 {
+			prev := out[len(out)-1]
+			if policy.MergeUserMessages && msg.Role == "user" && prev.Role == "user" {
+				out[len(out)-1] = mergeMessages(prev, msg)
+				continue
+			}
+		}
+		if policy.MergeSystemMessages && msg.Role == "system" && len(out) > 0 {
+			if out[0].Role == "system" {
+				out[0] = mergeMessages(out[0], msg)
+			} else {
+				out = slices.Insert(out, 0, msg)
+			}
+			continue
+		}
+		out = append(out, msg)
+	}
+	if lastAssistant >= 0 {
+		answer(lastAssistant)
+	}
+
+	kept := make(map[string]bool, len(out))
+	for _, msg := range out {
+		kept[msg.ID] = true
+	}
+	for _, msg := range chat.Messages {
+		switch {
+		case slices.Contains(out, msg):
+		case kept[msg.ID]:
+			// Replaced by a merged copy with the same ID
+			chat.replaceInTree(msg, msg.ID)
+		default:
+			chat.forgetMessage(msg)
+		}
+	}
+	previous, system := chat.Messages, chat.systemMessage()
+	chat.Messages = out
+	chat.linkMessages()
+	chat.LastUpdated = time.Now()
+	chat.notifyChanged(previous, system)
+	return chat.Validate()
+}
+
+// mergeMessages returns a copy of a with the content of b appended.
+// String contents are joined by a blank line; otherwise the parts are concatenated.
+func mergeMessages(a, b *Message) *Message {
+	merged := a.shallowCopy()
+	as, aok := a.Content.(string)
+	bs, bok := b.Content.(string)
+	if aok && bok {
+		merged.Content = as + "\n\n" + bs
+		return merged
+	}
+	merged.Content = append(contentAsParts(a), contentAsParts(b)...)
+	return merged
+}
+
+// contentAsParts returns the message content as parts, with string content as a text part
+func contentAsParts(msg *Message) []*Part {
+	if s, ok := msg.Content.(string); ok {
+		return []*Part{TextPart(s)}
+	}
+	parts, _ := msg.ContentParts()
+	return slices.Clone(parts)
+}
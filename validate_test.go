@@ -0,0 +1,136 @@
+package aichat_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/presbrey/aichat"
+)
+
+func weatherCall(id string) aichat.ToolCall {
+	return aichat.ToolCall{ID: id, Type: "function", Function: aichat.Function{Name: "get_weather", Arguments: "{}"}}
+}
+
+func problemKinds(problems []aichat.Problem) []aichat.ProblemKind {
+	var kinds []aichat.ProblemKind
+	for _, p := range problems {
+		kinds = append(kinds, p.Kind)
+	}
+	return kinds
+}
+
+func TestValidateValidTranscript(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.SetSystemContent("be brief")
+	chat.AddUserContent("weather?")
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1"), weatherCall("call_2")})
+	chat.AddToolRawContent("get_weather", "call_2", "sunny")
+	chat.AddToolRawContent("get_weather", "call_1", "rainy")
+	chat.AddAssistantContent("Mixed weather.")
+	assert.Empty(t, chat.Validate())
+	assert.Empty(t, chat.Repair(aichat.DefaultRepairPolicy))
+	assert.Len(t, chat.Messages, 6)
+}
+
+func TestValidate(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.AddUserContent("hello")
+	chat.AddUserContent("anyone there?")
+	chat.AddToolRawContent("get_weather", "call_0", "orphan")
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1"), weatherCall("call_2")})
+	chat.AddToolRawContent("get_weather", "call_1", "sunny")
+	chat.AddRoleContent("system", "late system prompt")
+	chat.AddAssistantContent("one")
+	chat.AddAssistantContent("two")
+	chat.AddToolRawContent("get_weather", "call_2", "too late")
+
+	problems := chat.Validate()
+	assert.Equal(t, []aichat.Problem{
+		{Kind: aichat.ProblemConsecutiveRole, Index: 1, MessageID: chat.Messages[1].ID},
+		{Kind: aichat.ProblemOrphanToolResult, Index: 2, MessageID: chat.Messages[2].ID, ToolCallID: "call_0"},
+		{Kind: aichat.ProblemUnansweredToolCall, Index: 3, MessageID: chat.Messages[3].ID, ToolCallID: "call_2"},
+		{Kind: aichat.ProblemMisplacedSystem, Index: 5, MessageID: chat.Messages[5].ID},
+		{Kind: aichat.ProblemConsecutiveRole, Index: 7, MessageID: chat.Messages[7].ID},
+		{Kind: aichat.ProblemOrphanToolResult, Index: 8, MessageID: chat.Messages[8].ID, ToolCallID: "call_2"},
+	}, problems)
+	assert.Equal(t, `message 3: tool call "call_2" has no tool result`, problems[2].String())
+}
+
+func TestRepair(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.AddUserContent("hello")
+	chat.AddUserContent("anyone there?")
+	chat.AddToolRawContent("get_weather", "call_0", "orphan")
+	call := chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1"), weatherCall("call_2")})
+	chat.AddToolRawContent("get_weather", "call_1", "sunny")
+	chat.AddRoleContent("system", "late system prompt")
+	chat.AddAssistantContent("one")
+	chat.AddAssistantContent("two")
+	first := chat.Messages[0]
+	first.Meta().Set("source", "web")
+
+	remaining := chat.Repair(aichat.DefaultRepairPolicy)
+	assert.Equal(t, []aichat.ProblemKind{aichat.ProblemConsecutiveRole}, problemKinds(remaining),
+		"consecutive assistant messages are not repaired")
+
+	require.Len(t, chat.Messages, 7)
+	assert.Equal(t, "system", chat.Messages[0].Role)
+	assert.Equal(t, "late system prompt", chat.Messages[0].Content)
+
+	assert.Equal(t, "hello\n\nanyone there?", chat.Messages[1].Content)
+	assert.Equal(t, first.ID, chat.Messages[1].ID, "merged messages keep the first ID")
+	assert.Equal(t, "hello", first.Content, "merged messages are copies")
+	chat.Messages[1].Meta().Set("source", "merged")
+	assert.Equal(t, "web", first.Meta().Get("source"), "merged messages do not share meta")
+
+	assert.Same(t, call, chat.Messages[2])
+	assert.Equal(t, "call_1", chat.Messages[3].ToolCallID)
+	placeholder := chat.Messages[4]
+	assert.Equal(t, "tool", placeholder.Role)
+	assert.Equal(t, "call_2", placeholder.ToolCallID)
+	assert.Equal(t, "get_weather", placeholder.Name)
+	assert.Equal(t, aichat.DefaultPlaceholderResult, placeholder.Content)
+	assert.NotEmpty(t, placeholder.ID)
+	assert.Equal(t, "one", chat.Messages[5].Content)
+}
+
+func TestRepairPolicy(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.SetSystemContent("be brief")
+	chat.AddUserContent("hi")
+	chat.AddRoleContent("system", "and polite")
+	chat.AddUserContent([]*aichat.Part{aichat.TextPart("look"), aichat.ImagePart("https://example.com/a.png")})
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1")})
+
+	// Only answer tool calls, with a custom placeholder
+	remaining := chat.Repair(aichat.RepairPolicy{AnswerToolCalls: true, PlaceholderResult: "canceled"})
+	assert.Equal(t, []aichat.ProblemKind{aichat.ProblemMisplacedSystem}, problemKinds(remaining))
+	assert.Equal(t, "canceled", chat.LastMessage().Content)
+
+	remaining = chat.Repair(aichat.DefaultRepairPolicy)
+	assert.Empty(t, remaining)
+	require.Len(t, chat.Messages, 4)
+	assert.Equal(t, "be brief\n\nand polite", chat.Messages[0].Content)
+	parts, err := chat.Messages[1].ContentParts()
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	assert.Equal(t, "hi", parts[0].Text)
+	assert.Equal(t, "look", parts[1].Text)
+	assert.Equal(t, aichat.PartTypeImageURL, parts[2].Type)
+}
+
+func TestRepairKeepsBranches(t *testing.T) {
+	chat := &aichat.Chat{}
+	chat.AddUserContent("hello")
+	chat.AddAssistantContent("hi")
+	chat.BranchAt(1)
+	chat.AddAssistantToolCall([]aichat.ToolCall{weatherCall("call_1")})
+
+	assert.Empty(t, chat.Repair(aichat.DefaultRepairPolicy))
+	require.Len(t, chat.Messages, 3)
+	assert.Equal(t, chat.Messages[1].ID, chat.Messages[2].ParentID)
+	assert.Len(t, chat.Branches(), 2)
+	assert.Len(t, chat.Children(chat.Messages[0].ID), 2)
+}